@@ -1,10 +1,10 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"net/http"
 
-	"github.com/ezhische/qrator-exporter/internal/config"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
@@ -17,26 +17,31 @@ func healthz(response http.ResponseWriter, request *http.Request) {
 func main() {
 	log := logrus.New()
 
-	conf, err := config.ConfigFromEnv()
-	if err != nil {
-		log.Fatalf("Can't create config: %v", err)
-	}
-	coll, err := config.CollectorFromConfig(conf, log)
-	if err != nil {
-		log.Fatalf("Can't create collector: %v", err)
+	configFile := flag.String("config.file", "", "Path to YAML config file, environment variables override its values")
+	flag.Parse()
+
+	exp := newExporter(*configFile, log)
+	if err := exp.reload(); err != nil {
+		log.Fatalf("Can't start exporter: %v", err)
 	}
-	prometheus.MustRegister(coll)
+	go exp.watchSignals()
+	prometheus.MustRegister(exp)
+
 	http.Handle("/metrics", promhttp.Handler())
+	http.HandleFunc("/probe", probeHandler(exp, log))
+	http.HandleFunc("/-/reload", exp.reloadHandler)
 	http.HandleFunc("/healthz", healthz)
+	http.HandleFunc("/readyz", exp.readyz)
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte(`<html>
 			<head><title>Qrator Exporter</title></head>
 			<body>
 			<h1>Qrator Exporter</h1>
 			<p><a href="/metrics">Metrics</a></p>
+			<p><a href="https://github.com/ezhische/qrator-exporter#multi-target-probe">Probe</a></p>
 			</body>
 			</html>`))
 	})
 	log.Infoln("Starting qrator-exporter")
-	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%v", conf.Port), nil))
+	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%v", exp.config().Port), nil))
 }
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ezhische/qrator-exporter/internal/config"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sirupsen/logrus"
+)
+
+// scrapeTimeoutOffset leaves time to encode and send the response.
+const scrapeTimeoutOffset = 500 * time.Millisecond
+
+// probeHandler serves /probe?client=<name>&domain=<id> by collecting metrics
+// of a single client from the clients file into a fresh registry.
+func probeHandler(e *exporter, log *logrus.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		conf := e.config()
+		params := r.URL.Query()
+		name := params.Get("client")
+		if name == "" {
+			http.Error(w, "client parameter is missing", http.StatusBadRequest)
+			return
+		}
+		domains, err := parseDomains(params["domain"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := probeContext(r, conf.PollTimeout)
+		defer cancel()
+
+		coll, err := e.probe(name)
+		if errors.Is(err, config.ErrUnknownClient) {
+			http.Error(w, fmt.Sprintf("unknown client %q", name), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			// The error may quote client settings, it's only logged.
+			log.Errorf("can't create collector for client %s: %v", name, err)
+			http.Error(w, fmt.Sprintf("can't create collector for client %q", name), http.StatusInternalServerError)
+			return
+		}
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(coll.Probe(ctx, domains))
+		promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+	}
+}
+
+// probeContext returns a context which is done shortly before Prometheus gives
+// up on the scrape. Without the scrape timeout header the fallback is used.
+func probeContext(r *http.Request, fallback time.Duration) (context.Context, context.CancelFunc) {
+	timeout := fallback
+	if v := r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds"); v != "" {
+		seconds, err := strconv.ParseFloat(v, 64)
+		if err == nil && seconds > 0 {
+			timeout = time.Duration(seconds * float64(time.Second))
+			if timeout > scrapeTimeoutOffset {
+				timeout -= scrapeTimeoutOffset
+			}
+		}
+	}
+	if timeout <= 0 {
+		return context.WithCancel(r.Context())
+	}
+	return context.WithTimeout(r.Context(), timeout)
+}
+
+// parseDomains accepts both repeated and comma separated domain parameters.
+// Repeated IDs are dropped.
+func parseDomains(values []string) ([]int, error) {
+	var domains []int
+	for _, value := range values {
+		for _, id := range strings.Split(value, ",") {
+			domain, err := strconv.Atoi(strings.TrimSpace(id))
+			if err != nil {
+				return nil, fmt.Errorf("invalid domain id %q", id)
+			}
+			if !slices.Contains(domains, domain) {
+				domains = append(domains, domain)
+			}
+		}
+	}
+	return domains, nil
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/ezhische/qrator-exporter/internal/collector"
+	"github.com/ezhische/qrator-exporter/internal/config"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+// exporter holds the current config and collector and swaps them on reload.
+// It is registered in place of the collector, so scrapes always go to the
+// current one.
+type exporter struct {
+	configFile string
+	log        *logrus.Logger
+
+	// reloadMu serializes reloads
+	reloadMu sync.Mutex
+
+	mu   sync.RWMutex
+	conf *config.Config
+	coll *collector.Collector
+	stop context.CancelFunc
+	// probes caches collectors of /probe targets by client name, they are
+	// dropped on reload
+	probes map[string]*collector.Collector
+
+	reloadSuccess     prometheus.Gauge
+	reloadSuccessTime prometheus.Gauge
+	reloadFailures    prometheus.Counter
+}
+
+func newExporter(configFile string, log *logrus.Logger) *exporter {
+	return &exporter{
+		configFile: configFile,
+		log:        log,
+		reloadSuccess: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "qrator",
+			Name:      "exporter_config_last_reload_successful",
+			Help:      "Whether the last configuration reload attempt was successful",
+		}),
+		reloadSuccessTime: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "qrator",
+			Name:      "exporter_config_last_reload_success_timestamp_seconds",
+			Help:      "Unix time of the last successful configuration reload",
+		}),
+		reloadFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "qrator",
+			Name:      "exporter_config_reload_failures_total",
+			Help:      "Count of failed configuration reloads",
+		}),
+	}
+}
+
+// reload loads the config and creates a new collector. The running ones are
+// replaced only if both succeed.
+func (e *exporter) reload() error {
+	e.reloadMu.Lock()
+	defer e.reloadMu.Unlock()
+
+	err := e.load()
+	if err != nil {
+		e.reloadSuccess.Set(0)
+		e.reloadFailures.Inc()
+		return err
+	}
+	e.reloadSuccess.Set(1)
+	e.reloadSuccessTime.SetToCurrentTime()
+	return nil
+}
+
+func (e *exporter) load() error {
+	conf, err := config.Load(e.configFile)
+	if err != nil {
+		return fmt.Errorf("can't load config: %w", err)
+	}
+
+	e.mu.RLock()
+	prevConf, prevColl := e.conf, e.coll
+	e.mu.RUnlock()
+	if prevConf != nil && prevConf.LegacyLabels != conf.LegacyLabels {
+		e.log.Warnf("legacy_labels change to %v requires restart, keeping %v", conf.LegacyLabels, prevConf.LegacyLabels)
+		conf.LegacyLabels = prevConf.LegacyLabels
+	}
+	if prevConf != nil && conf.Equal(prevConf) {
+		e.log.Infoln("config is unchanged, keeping the running collector")
+		return nil
+	}
+
+	var coll *collector.Collector
+	stop := func() {}
+	if len(conf.Accounts()) > 0 {
+		coll, err = config.CollectorFromConfig(conf, e.log)
+		if err != nil {
+			return fmt.Errorf("can't create collector: %w", err)
+		}
+		if prevColl != nil {
+			coll.Inherit(prevColl)
+		}
+		var ctx context.Context
+		ctx, stop = context.WithCancel(context.Background())
+		go coll.Run(ctx)
+	}
+
+	e.mu.Lock()
+	prev, prevStop, prevProbes := e.conf, e.stop, e.probes
+	e.conf, e.coll, e.stop, e.probes = conf, coll, stop, nil
+	e.mu.Unlock()
+
+	if prevStop != nil {
+		prevStop()
+	}
+	if prevColl != nil {
+		prevColl.Close()
+	}
+	for _, coll := range prevProbes {
+		coll.Close()
+	}
+	if prev != nil && prev.Port != conf.Port {
+		e.log.Warnf("port change from %d to %d requires restart", prev.Port, conf.Port)
+	}
+	return nil
+}
+
+// probe returns the cached collector of the named client, it is created on
+// first use.
+func (e *exporter) probe(name string) (*collector.Collector, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if coll, ok := e.probes[name]; ok {
+		return coll, nil
+	}
+	coll, err := config.ProbeCollector(e.conf, name, e.log)
+	if err != nil {
+		return nil, err
+	}
+	if e.probes == nil {
+		e.probes = make(map[string]*collector.Collector)
+	}
+	e.probes[name] = coll
+	return coll, nil
+}
+
+func (e *exporter) config() *config.Config {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.conf
+}
+
+// Describe sends descriptors of the collector metrics and the reload metrics.
+// They are sent once on registration, so the label set of the collector
+// metrics is fixed at startup, see load.
+func (e *exporter) Describe(ch chan<- *prometheus.Desc) {
+	collector.Describe(e.config().LegacyLabels, ch)
+	ch <- e.reloadSuccess.Desc()
+	ch <- e.reloadSuccessTime.Desc()
+	ch <- e.reloadFailures.Desc()
+}
+
+func (e *exporter) Collect(ch chan<- prometheus.Metric) {
+	e.mu.RLock()
+	coll := e.coll
+	e.mu.RUnlock()
+
+	if coll != nil {
+		coll.Collect(ch)
+	}
+	ch <- e.reloadSuccess
+	ch <- e.reloadSuccessTime
+	ch <- e.reloadFailures
+}
+
+// readyz reports whether the API has been reachable with valid credentials
+// for every polled account. Accounts whose credentials didn't change on
+// reload stay ready, see collector.Inherit.
+func (e *exporter) readyz(w http.ResponseWriter, r *http.Request) {
+	e.mu.RLock()
+	coll := e.coll
+	e.mu.RUnlock()
+
+	if coll != nil && !coll.Ready() {
+		http.Error(w, "Qrator API is not reachable", http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+// reloadHandler serves POST /-/reload.
+func (e *exporter) reloadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "only POST requests allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := e.reload(); err != nil {
+		e.log.Errorf("config reload failed: %v", err)
+		http.Error(w, fmt.Sprintf("failed to reload config: %v", err), http.StatusInternalServerError)
+		return
+	}
+	e.log.Infoln("config reloaded")
+	fmt.Fprintln(w, "ok")
+}
+
+// watchSignals reloads the config on every SIGHUP.
+func (e *exporter) watchSignals() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		if err := e.reload(); err != nil {
+			e.log.Errorf("config reload failed: %v", err)
+			continue
+		}
+		e.log.Infoln("config reloaded")
+	}
+}
@@ -0,0 +1,128 @@
+package collector
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ezhische/qrator-exporter/qrator"
+	"github.com/ezhische/qrator-exporter/qrator/entity"
+)
+
+// Account is a Qrator client account polled by the collector.
+type Account struct {
+	APIKey string
+	// APIKeyFile is read instead of APIKey if set
+	APIKeyFile string
+	ClientID   int
+	APIURL     string
+	Domains    []int
+	ProxyURL   string
+	// DNSDomains are domain IDs with DNS protection, DNS stats are only
+	// requested for them
+	DNSDomains []int
+}
+
+type account struct {
+	// conf is the account the collector was created with
+	conf        Account
+	clientID    int
+	domainsList []int
+	// names caches resolved domain names, probes share it
+	names      map[int]string
+	namesMu    sync.Mutex
+	client     *qrator.Client
+	httpClient *http.Client
+	// label is the client_id label value
+	label string
+	// ready is set once the API has been reached with valid credentials
+	ready atomic.Bool
+	// up is set if the last API call succeeded
+	up atomic.Bool
+
+	// dnsDomains holds domains with DNS protection
+	dnsDomains map[int]bool
+}
+
+func (c *Collector) newAccount(acc Account) (*account, error) {
+	httpClient, err := qrator.NewHTTPClient(acc.ProxyURL, c.config.timeout)
+	if err != nil {
+		return nil, err
+	}
+	c.instrument(httpClient)
+	auth := qrator.WithAuth(acc.APIKey)
+	if acc.APIKeyFile != "" {
+		auth = qrator.WithTokenSource(qrator.NewFileToken(acc.APIKeyFile))
+	}
+	a := &account{
+		conf:        acc,
+		clientID:    acc.ClientID,
+		domainsList: acc.Domains,
+		names:       make(map[int]string, len(acc.Domains)),
+		dnsDomains:  make(map[int]bool, len(acc.DNSDomains)),
+		label:       strconv.Itoa(acc.ClientID),
+		httpClient:  httpClient,
+	}
+	for _, id := range acc.DNSDomains {
+		a.dnsDomains[id] = true
+	}
+	opts := append([]qrator.Option{
+		qrator.WithHTTPClient(httpClient),
+		auth,
+		qrator.WithBaseURL(acc.APIURL),
+		qrator.WithLogger(c.config.logger),
+		qrator.WithObserver(observer{c, a}),
+	}, c.config.clientOptions...)
+	a.client = qrator.New(opts...)
+	return a, nil
+}
+
+// name returns the cached name of the domain.
+func (a *account) name(id int) (string, bool) {
+	a.namesMu.Lock()
+	defer a.namesMu.Unlock()
+	name, ok := a.names[id]
+	return name, ok
+}
+
+func (a *account) setName(id int, name string) {
+	a.namesMu.Lock()
+	defer a.namesMu.Unlock()
+	a.names[id] = name
+}
+
+// sameCredentials reports whether a and b reach the API the same way.
+func sameCredentials(a, b Account) bool {
+	return a.ClientID == b.ClientID &&
+		a.APIKey == b.APIKey &&
+		a.APIKeyFile == b.APIKeyFile &&
+		a.APIURL == b.APIURL &&
+		a.ProxyURL == b.ProxyURL
+}
+
+// observer exports request layer events of qrator.Client as metrics.
+type observer struct {
+	c *Collector
+	a *account
+}
+
+func (o observer) Retry(method entity.APIMethod) {
+	o.c.apiRetries.WithLabelValues(method.String()).Inc()
+}
+
+func (o observer) RateLimiterWait(d time.Duration) {
+	o.c.rateLimiterWait.Observe(d.Seconds())
+}
+
+// Success marks the account ready: the API answered with valid credentials.
+func (o observer) Success(entity.APIMethod) {
+	o.a.up.Store(true)
+	o.c.setReady(o.a)
+}
+
+func (o observer) Error(err *qrator.APIError) {
+	o.a.up.Store(false)
+	o.c.apiErrors.WithLabelValues(err.Method.String(), err.Class.String()).Inc()
+}
@@ -1,153 +1,139 @@
 package collector
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
-	"net/http"
+	"slices"
+	"strconv"
 
-	"github.com/ezhische/qrator-exporter/internal/collector/entity"
-	log "github.com/sirupsen/logrus"
+	"github.com/ezhische/qrator-exporter/qrator/entity"
 )
 
-func (c *Collector) qratorPostRequest(methodClass entity.MethodClass, id int, method entity.APIMethod) (*http.Response, error) {
-	reqURL := fmt.Sprintf("%s/%s/%d", c.config.qratorAPIURL, methodClass.String(), id)
-	reqBody := entity.QratorRequest{
-		Method: method.String(),
-		ID:     1,
+// getQratorDomains returns all domains of the account or, if ids or
+// domainsList is set, only those domains. Domains missing from domains_get are
+// still polled, their name is resolved one by one.
+func (c *Collector) getQratorDomains(ctx context.Context, a *account, ids []int) ([]entity.QratorDomain, error) {
+	if len(ids) == 0 {
+		ids = a.domainsList
 	}
-	body, err := json.Marshal(reqBody)
-	if err != nil {
-		return nil, fmt.Errorf("error marshaling request: %w", err)
+	all, err := a.client.DomainsGet(ctx, a.clientID)
+	if len(ids) == 0 {
+		return all, err
 	}
-	req, err := http.NewRequest(http.MethodPost, reqURL, bytes.NewBuffer(body))
 	if err != nil {
-		return nil, fmt.Errorf("cannot create new request: %w", err)
+		c.failedDomainScrapes.Inc()
+		c.config.logger.Errorf("got error while getting domains for client id %d, resolving names by id: %v", a.clientID, err)
 	}
-	defer req.Body.Close()
-	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("X-Qrator-Auth", c.config.aPIKey)
-
-	client := c.client
-	response, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("error making new request: %w", err)
+	byID := make(map[int]entity.QratorDomain, len(all))
+	for _, qd := range all {
+		byID[qd.ID] = qd
 	}
-	return response, nil
-}
 
-func (c *Collector) getQratorDomains() ([]entity.QratorDomain, error) {
-	if len(c.config.domainsList) > 0 {
-		var list []entity.QratorDomain
-		for _, domain := range c.config.domainsList {
-			qds, err := c.getQratorDomainName(domain)
-			if err != nil {
-				log.Errorf("got error while getting domain name for id: %v %v", domain, err)
-				continue
+	var list []entity.QratorDomain
+	for _, domain := range ids {
+		if qd, ok := byID[domain]; ok {
+			a.setName(domain, qd.Name)
+			list = append(list, qd)
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		name, err := a.client.DomainName(ctx, domain)
+		if err != nil {
+			// Keep polling the domain under its last known name, or its ID
+			// if it has never been resolved.
+			known, ok := a.name(domain)
+			if !ok {
+				known = strconv.Itoa(domain)
 			}
-			list = append(list, entity.QratorDomain{ID: domain, Name: qds.Result})
+			c.config.logger.Errorf("got error while getting domain name for id: %v, using %q: %v", domain, known, err)
+			name = known
 		}
-		return list, nil
+		a.setName(domain, name)
+		list = append(list, entity.QratorDomain{ID: domain, Name: name})
 	}
+	return list, nil
+}
 
-	r, err := c.qratorPostRequest(entity.Client, c.config.clientID, entity.GetDomains)
-	if err != nil {
-		return nil, err
-	}
-	defer r.Body.Close()
-	qds := entity.QratorDomains{}
-	err = json.NewDecoder(r.Body).Decode(&qds)
+func (c *Collector) qratorCheck(ctx context.Context, a *account) error {
+	// A successful call marks the account ready, see observer.Success.
+	_, err := a.client.SourceIPsGet(ctx, a.clientID)
+	return err
+}
+
+// getQratorSourceIPs returns sorted Qrator source IPs of the account.
+func (c *Collector) getQratorSourceIPs(ctx context.Context, a *account) ([]string, error) {
+	ips, err := a.client.SourceIPsGet(ctx, a.clientID)
 	if err != nil {
-		log.Errorf("Can't decode received json: %v", err)
 		return nil, err
 	}
-	if qds.Error != "" {
-		log.Errorf("wrong request: %s", qds.Error)
-		return nil, fmt.Errorf("wrong request: %s", qds.Error)
-	}
-	return qds.Domains, nil
+	slices.Sort(ips)
+	return slices.Compact(ips), nil
 }
 
-func (c *Collector) getQratorDomainName(domainID int) (*entity.QratorResponseDomainName, error) {
-	r, err := c.qratorPostRequest(entity.Domain, domainID, entity.Name)
+func (c *Collector) getQratorDomainHTTPStats(ctx context.Context, a *account, qd entity.QratorDomain) (*entity.HTTPStatsResult, error) {
+	stats, err := a.client.DomainHTTPStats(ctx, qd.ID)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("domain %s: %w", qd.Name, err)
 	}
-	defer r.Body.Close()
-	qds := &entity.QratorResponseDomainName{}
+	return stats, nil
+}
 
-	err = json.NewDecoder(r.Body).Decode(&qds)
+func (c *Collector) getQratorDomainIPStats(ctx context.Context, a *account, qd entity.QratorDomain) (*entity.DomainIPStatsResult, error) {
+	stats, err := a.client.DomainIPStats(ctx, qd.ID)
 	if err != nil {
-		log.Errorf("Can't decode received json: %v", err)
-		return nil, fmt.Errorf("parse error %w", err)
+		return nil, fmt.Errorf("domain %s: %w", qd.Name, err)
 	}
-	return qds, nil
+	return stats, nil
 }
 
-func (c *Collector) qratorCheck() error {
-	r, err := c.qratorPostRequest(entity.Client, c.config.clientID, entity.Ping)
+func (c *Collector) getQratorDomainBillableStats(ctx context.Context, a *account, qd entity.QratorDomain) (*float64, error) {
+	stats, err := a.client.DomainBillableStats(ctx, qd.ID)
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("domain %s: %w", qd.Name, err)
 	}
-	defer r.Body.Close()
-	ping := entity.QratorPing{}
-	err = json.NewDecoder(r.Body).Decode(&ping)
+	return &stats, nil
+}
+
+func (c *Collector) getQratorDomainUpstreams(ctx context.Context, a *account, qd entity.QratorDomain) ([]entity.DomainUpstream, error) {
+	upstreams, err := a.client.DomainUpstreams(ctx, qd.ID)
 	if err != nil {
-		return fmt.Errorf("got error while decoding json. %w", err)
-	}
-	if ping.Error != "" {
-		return fmt.Errorf("got error in response: %s", ping.Error)
+		return nil, fmt.Errorf("domain %s: %w", qd.Name, err)
 	}
-	return nil
+	return upstreams, nil
 }
 
-func (c *Collector) getQratorDomainHTTPStats(qd entity.QratorDomain) (*entity.QratorDomainHTTPStats, error) {
-	r, err := c.qratorPostRequest("domain", qd.ID, "statistics_current_http")
-	if err != nil {
-		return nil, err
+func (c *Collector) getQratorDomainList(ctx context.Context, a *account, qd entity.QratorDomain, list entity.APIMethod) ([]entity.ListEntry, error) {
+	get := a.client.DomainBlacklist
+	if list == entity.Whitelist {
+		get = a.client.DomainWhitelist
 	}
-	defer r.Body.Close()
-	stats := &entity.QratorDomainHTTPStats{}
-	err = json.NewDecoder(r.Body).Decode(&stats)
+	entries, err := get(ctx, qd.ID)
 	if err != nil {
-		return nil, fmt.Errorf("parse error for domain %s:%w", qd.Name, err)
+		return nil, fmt.Errorf("domain %s: %w", qd.Name, err)
 	}
-	if stats.Error != nil {
-		return nil, fmt.Errorf("wrong request for domain %s : %s", qd.Name, *stats.Error)
+	if entries == nil {
+		entries = []entity.ListEntry{}
 	}
-	return stats, nil
+	return entries, nil
 }
 
-func (c *Collector) getQratorDomainIPStats(qd entity.QratorDomain) (*entity.QratorDomainIPStats, error) {
-	r, err := c.qratorPostRequest(entity.Domain, qd.ID, entity.IP)
+func (c *Collector) getQratorDomainCertificates(ctx context.Context, a *account, qd entity.QratorDomain) ([]entity.Certificate, error) {
+	certs, err := a.client.DomainCertificates(ctx, qd.ID)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("domain %s: %w", qd.Name, err)
 	}
-	defer r.Body.Close()
-	stats := &entity.QratorDomainIPStats{}
-	err = json.NewDecoder(r.Body).Decode(&stats)
-	if err != nil {
-		return nil, fmt.Errorf("parse error for domain %s:%w", qd.Name, err)
-	}
-	if stats.Error != nil {
-		return nil, fmt.Errorf("wrong request for domain %s : %s", qd.Name, *stats.Error)
+	if certs == nil {
+		certs = []entity.Certificate{}
 	}
-	return stats, nil
+	return certs, nil
 }
 
-func (c *Collector) getQratorDomainBillableStats(qd entity.QratorDomain) (*entity.QratorDomainBillStats, error) {
-	r, err := c.qratorPostRequest(entity.Domain, qd.ID, entity.Bill)
+func (c *Collector) getQratorDomainDNSStats(ctx context.Context, a *account, qd entity.QratorDomain) (*entity.DNSStatsResult, error) {
+	stats, err := a.client.DomainDNSStats(ctx, qd.ID)
 	if err != nil {
-		return nil, err
-	}
-	defer r.Body.Close()
-	stats := &entity.QratorDomainBillStats{}
-	err = json.NewDecoder(r.Body).Decode(&stats)
-	if err != nil {
-		return nil, fmt.Errorf("parse error for domain %s:%w", qd.Name, err)
-	}
-	if stats.Error != nil {
-		return nil, fmt.Errorf("wrong request for domain %s : %s", qd.Name, *stats.Error)
+		return nil, fmt.Errorf("domain %s: %w", qd.Name, err)
 	}
 	return stats, nil
 }
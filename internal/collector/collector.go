@@ -1,13 +1,20 @@
 package collector
 
 import (
+	"cmp"
+	"context"
 	"fmt"
-	"net/http"
-	"net/url"
+	"hash/fnv"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/ezhische/qrator-exporter/internal/collector/entity"
+	"github.com/ezhische/qrator-exporter/qrator"
+	"github.com/ezhische/qrator-exporter/qrator/entity"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
 )
@@ -15,49 +22,109 @@ import (
 const (
 	namespace = "qrator"
 	gCount    = 10 //Количество горутин для сбора метрик
+	// domainOnline is the status of a domain under normal protection
+	domainOnline = "online"
 )
 
 type Collector struct {
-	config *config
-	client *http.Client
-
-	bypassedTraffic   prometheus.GaugeVec
-	incomingTraffic   prometheus.GaugeVec
-	outgoingTraffic   prometheus.GaugeVec
-	bypassedPackets   prometheus.GaugeVec
-	incomingPackets   prometheus.GaugeVec
-	outgoingPackets   prometheus.GaugeVec
-	requestRate       prometheus.GaugeVec
-	slowRequestsCount prometheus.GaugeVec
-	errorsCount       prometheus.GaugeVec
-	bannedIPs         prometheus.GaugeVec
-	billableTraffic   prometheus.GaugeVec
-
-	totalScrapes            prometheus.Counter
-	failedDomainScrapes     prometheus.Counter
-	failedDomainHTTPScrapes prometheus.Counter
-	failedDomainBillScrapes prometheus.Counter
-	failedDomainIPScrapes   prometheus.Counter
+	config   *config
+	accounts []*account
+
+	bypassedTraffic   *prometheus.Desc
+	incomingTraffic   *prometheus.Desc
+	outgoingTraffic   *prometheus.Desc
+	bypassedPackets   *prometheus.Desc
+	incomingPackets   *prometheus.Desc
+	outgoingPackets   *prometheus.Desc
+	requestRate       *prometheus.Desc
+	slowRequestsCount *prometheus.Desc
+	errorsCount       *prometheus.Desc
+	bannedIPs         *prometheus.Desc
+	billableTraffic   *prometheus.Desc
+	dnsRequestRate    *prometheus.Desc
+	dnsResponses      *prometheus.Desc
+	upstreamInfo      *prometheus.Desc
+	upstreams         *prometheus.Desc
+	listEntries       *prometheus.Desc
+	listNextExpiry    *prometheus.Desc
+	listEntryExpiry   *prometheus.Desc
+	certExpiry        *prometheus.Desc
+	up                *prometheus.Desc
+	sourceIPInfo      *prometheus.Desc
+	sourceIPsHash     *prometheus.Desc
+	domainInfo        *prometheus.Desc
+	domainStatus      *prometheus.Desc
+	scrapeSuccess     *prometheus.Desc
+	scrapeDuration    *prometheus.Desc
+	responseDuration  *prometheus.Desc
+
+	totalScrapes                prometheus.Counter
+	failedDomainScrapes         prometheus.Counter
+	failedDomainHTTPScrapes     prometheus.Counter
+	failedDomainBillScrapes     prometheus.Counter
+	failedDomainIPScrapes       prometheus.Counter
+	failedDomainDNSScrapes      prometheus.Counter
+	failedDomainUpstreamScrapes prometheus.Counter
+	failedDomainListScrapes     prometheus.Counter
+	failedDomainCertScrapes     prometheus.Counter
+	apiRetries                  prometheus.CounterVec
+	apiErrors                   prometheus.CounterVec
+	circuitState                *prometheus.Desc
+	rateLimiterWait             prometheus.Histogram
+	apiRequestDuration          prometheus.HistogramVec
+	apiInFlight                 prometheus.GaugeVec
+
+	lastPollTimestamp *prometheus.Desc
+	lastPollDuration  *prometheus.Desc
+	snapshotAge       *prometheus.Desc
+	domainsPolled     *prometheus.Desc
+
+	snapshot *snapshot
+	// accountReady wakes up Run when an account passes the API check
+	accountReady chan struct{}
+	// polling is set while Poll is running
+	polling atomic.Bool
 	sync.Mutex
 }
 
+// Extras selects API calls made for every domain in addition to the
+// statistics. Each of them adds calls to every poll, so they are off by
+// default.
+type Extras struct {
+	Upstreams bool
+	// Lists are the blacklist and the whitelist
+	Lists        bool
+	Certificates bool
+}
+
 type config struct {
-	aPIKey       string
-	clientID     int
-	qratorAPIURL string
-	domainsList  []int
-	proxyURL     string
+	accounts     []Account
 	timeout      time.Duration
 	logger       *logrus.Logger
 	con          int
+	pollInterval time.Duration
+	pollTimeout  time.Duration
+	// legacyLabels drops the domain_id label from per-domain metrics
+	legacyLabels bool
+	// listEntriesLimit is the max number of blacklist and whitelist entries
+	// exported per domain and list, 0 disables entry metrics
+	listEntriesLimit int
+	extras           Extras
+	// clientOptions are applied to the API client of every account
+	clientOptions []qrator.Option
 }
 
 type Semaphore struct {
 	C chan struct{}
 }
 
-func (s *Semaphore) Acquire() {
-	s.C <- struct{}{}
+func (s *Semaphore) Acquire(ctx context.Context) error {
+	select {
+	case s.C <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 func (s *Semaphore) Release() {
@@ -65,41 +132,65 @@ func (s *Semaphore) Release() {
 }
 
 func CollectorFromConfig(
-	apiKey string,
-	clientID int,
-	apiURL string,
-	domainsList []int,
-	proxy string,
+	accounts []Account,
 	timeout time.Duration,
 	logger *logrus.Logger,
 	con int,
+	pollInterval time.Duration,
+	pollTimeout time.Duration,
+	legacyLabels bool,
+	listEntriesLimit int,
+	extras Extras,
+	clientOptions ...qrator.Option,
 ) (*Collector, error) {
 	conf := &config{
-		aPIKey:       apiKey,
-		clientID:     clientID,
-		qratorAPIURL: apiURL,
-		domainsList:  domainsList,
-		timeout:      timeout,
-		proxyURL:     proxy,
-		logger:       logger,
-		con:          con,
+		accounts:         accounts,
+		timeout:          timeout,
+		logger:           logger,
+		con:              con,
+		pollInterval:     pollInterval,
+		pollTimeout:      pollTimeout,
+		legacyLabels:     legacyLabels,
+		listEntriesLimit: listEntriesLimit,
+		extras:           extras,
+		clientOptions:    clientOptions,
 	}
 	return NewCollector(conf)
 }
 
 func NewCollector(conf *config) (*Collector, error) {
-	client, err := newClient(conf.proxyURL, conf.timeout)
-	if err != nil {
-		return &Collector{}, fmt.Errorf("error creating client: %w", err)
+	if conf.pollInterval <= 0 {
+		return nil, fmt.Errorf("poll interval must be positive, got %v", conf.pollInterval)
+	}
+	if conf.pollTimeout <= 0 {
+		conf.pollTimeout = conf.pollInterval
+	}
+	if len(conf.accounts) == 0 {
+		return nil, fmt.Errorf("no client accounts configured")
 	}
 
-	collector := &Collector{
-		config: conf,
-		client: client,
+	collector := newCollector(conf)
+	for _, acc := range conf.accounts {
+		a, err := collector.newAccount(acc)
+		if err != nil {
+			return nil, fmt.Errorf("error creating client for client id %d: %w", acc.ClientID, err)
+		}
+		collector.accounts = append(collector.accounts, a)
 	}
-	err = collector.qratorCheck()
-	if err != nil {
-		return nil, err
+	return collector, nil
+}
+
+// Describe sends the descriptors a collector with the legacyLabels setting
+// sends, it can be used before any collector is created.
+func Describe(legacyLabels bool, ch chan<- *prometheus.Desc) {
+	newCollector(&config{legacyLabels: legacyLabels}).Describe(ch)
+}
+
+// newCollector creates a collector with all metrics but no accounts.
+func newCollector(conf *config) *Collector {
+	collector := &Collector{
+		config:       conf,
+		accountReady: make(chan struct{}, 1),
 	}
 
 	collector.totalScrapes = prometheus.NewCounter(prometheus.CounterOpts{
@@ -126,282 +217,644 @@ func NewCollector(conf *config) (*Collector, error) {
 		Help:      "Count of failed stats scrapes",
 	})
 
+	collector.failedDomainDNSScrapes = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "exporter_failed_domain_dns_stats_scrapes_total",
+		Help:      "Count of failed stats scrapes",
+	})
+
+	collector.failedDomainUpstreamScrapes = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "exporter_failed_domain_upstream_scrapes_total",
+		Help:      "Count of failed upstream scrapes",
+	})
+
+	collector.failedDomainListScrapes = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "exporter_failed_domain_list_scrapes_total",
+		Help:      "Count of failed blacklist and whitelist scrapes",
+	})
+
+	collector.failedDomainCertScrapes = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "exporter_failed_domain_certificate_scrapes_total",
+		Help:      "Count of failed certificate scrapes",
+	})
+
 	collector.failedDomainBillScrapes = prometheus.NewCounter(prometheus.CounterOpts{
 		Namespace: namespace,
 		Name:      "exporter_failed_domain_billable_stats_scrapes_total",
 		Help:      "Count of failed stats scrapes",
 	})
 
-	collector.bypassedTraffic = *prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
+	collector.apiRetries = *prometheus.NewCounterVec(
+		prometheus.CounterOpts{
 			Namespace: namespace,
-			Name:      "bypassed_traffic",
-			Help:      "Bypassed traffic (bps)",
+			Name:      "exporter_api_retries_total",
+			Help:      "Count of retried API requests",
 		},
 		[]string{
-			"domain",
+			"method",
 		},
 	)
 
-	collector.incomingTraffic = *prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
+	collector.apiErrors = *prometheus.NewCounterVec(
+		prometheus.CounterOpts{
 			Namespace: namespace,
-			Name:      "incoming_traffic",
-			Help:      "Incoming traffic (bps)",
+			Name:      "exporter_api_errors_total",
+			Help:      "Count of failed API calls by error class",
 		},
 		[]string{
-			"domain",
+			"method",
+			"class",
 		},
 	)
 
-	collector.outgoingTraffic = *prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Namespace: namespace,
-			Name:      "outgoing_traffic",
-			Help:      "Outgoing traffic (bps)",
-		},
+	collector.circuitState = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "exporter_api_circuit_state"),
+		"State of the API circuit breaker (0 - closed, 1 - half-open, 2 - open)",
 		[]string{
-			"domain",
+			"client_id",
 		},
+		nil,
 	)
 
-	collector.bypassedPackets = *prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
+	collector.rateLimiterWait = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "exporter_api_rate_limiter_wait_seconds",
+		Help:      "Time API requests spent waiting on the rate limiter",
+		Buckets:   prometheus.ExponentialBuckets(0.005, 2, 12),
+	})
+
+	collector.apiRequestDuration = *prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
 			Namespace: namespace,
-			Name:      "bypassed_packets",
-			Help:      "Bypassed packets (pps)",
+			Name:      "exporter_api_request_duration_seconds",
+			Help:      "Latency of API requests by method and HTTP status",
+			Buckets:   prometheus.DefBuckets,
 		},
 		[]string{
-			"domain",
+			"method_class",
+			"method",
+			"status",
 		},
 	)
 
-	collector.incomingPackets = *prometheus.NewGaugeVec(
+	collector.apiInFlight = *prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Namespace: namespace,
-			Name:      "incoming_packets",
-			Help:      "Incoming packets (pps)",
+			Name:      "exporter_api_requests_in_flight",
+			Help:      "Count of API requests in flight by method",
 		},
 		[]string{
-			"domain",
+			"method_class",
+			"method",
 		},
 	)
-	collector.outgoingPackets = *prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Namespace: namespace,
-			Name:      "output_packets",
-			Help:      "Output packets (pps)",
-		},
-		[]string{
-			"domain",
-		},
+
+	collector.lastPollTimestamp = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "exporter_last_poll_timestamp_seconds"),
+		"Unix time of the last completed API poll",
+		nil,
+		nil,
 	)
 
-	collector.requestRate = *prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Namespace: namespace,
-			Name:      "request_rate",
-			Help:      "Request rate (rps)",
-		},
+	collector.lastPollDuration = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "exporter_last_poll_duration_seconds"),
+		"Duration of the last completed API poll",
+		nil,
+		nil,
+	)
+
+	collector.snapshotAge = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "exporter_snapshot_age_seconds"),
+		"Age of the served metrics snapshot",
+		nil,
+		nil,
+	)
+
+	collector.domainsPolled = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "exporter_client_last_success_timestamp_seconds"),
+		"Unix time the domain list of the client was last fetched",
 		[]string{
-			"domain",
+			"client_id",
 		},
+		nil,
 	)
 
-	collector.slowRequestsCount = *prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Namespace: namespace,
-			Name:      "slow_requests_count",
-			Help:      "Slow request count by treshold",
-		},
+	collector.bypassedTraffic = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "bypassed_traffic"),
+		"Bypassed traffic (bps)",
+		collector.domainLabels(),
+		nil,
+	)
+
+	collector.incomingTraffic = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "incoming_traffic"),
+		"Incoming traffic (bps)",
+		collector.domainLabels(),
+		nil,
+	)
+
+	collector.outgoingTraffic = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "outgoing_traffic"),
+		"Outgoing traffic (bps)",
+		collector.domainLabels(),
+		nil,
+	)
+
+	collector.bypassedPackets = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "bypassed_packets"),
+		"Bypassed packets (pps)",
+		collector.domainLabels(),
+		nil,
+	)
+
+	collector.incomingPackets = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "incoming_packets"),
+		"Incoming packets (pps)",
+		collector.domainLabels(),
+		nil,
+	)
+	collector.outgoingPackets = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "output_packets"),
+		"Output packets (pps)",
+		collector.domainLabels(),
+		nil,
+	)
+
+	collector.requestRate = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "request_rate"),
+		"Request rate (rps)",
+		collector.domainLabels(),
+		nil,
+	)
+
+	collector.slowRequestsCount = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "slow_requests_count"),
+		"Slow request count by treshold",
+		collector.domainLabels("treshold_seconds"),
+		nil,
+	)
+
+	collector.errorsCount = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "errors_count"),
+		"Errors count by code",
+		collector.domainLabels("code"),
+		nil,
+	)
+
+	collector.bannedIPs = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "banned_ip_addresses_count"),
+		"Number of IPs banned by Qrator",
+		collector.domainLabels("source"),
+		nil,
+	)
+
+	collector.responseDuration = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "response_duration_seconds"),
+		"Response time distribution of the domain built from HTTP stats buckets. Bucket values and count are response rates multiplied by 1000, sum is not provided by the API and is always 0",
+		collector.domainLabels(),
+		nil,
+	)
+
+	collector.up = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "up"),
+		"Whether the last Qrator API call of the client succeeded",
 		[]string{
-			"domain",
-			"treshold_seconds",
+			"client_id",
 		},
+		nil,
 	)
 
-	collector.errorsCount = *prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Namespace: namespace,
-			Name:      "errors_count",
-			Help:      "Errors count by code",
-		},
+	collector.sourceIPInfo = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "source_ip_info"),
+		"Qrator source IP which has to be allowed on the origin, always 1",
 		[]string{
-			"domain",
-			"code",
+			"client_id",
+			"ip",
 		},
+		nil,
 	)
 
-	collector.bannedIPs = *prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Namespace: namespace,
-			Name:      "banned_ip_addresses_count",
-			Help:      "Number of IPs banned by Qrator",
-		},
+	collector.sourceIPsHash = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "source_ips_hash"),
+		"FNV-1a hash of the sorted Qrator source IPs, changes with the set",
 		[]string{
-			"domain",
-			"source",
+			"client_id",
 		},
+		nil,
 	)
 
-	collector.billableTraffic = *prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Namespace: namespace,
-			Name:      "billable_traffic",
-			Help:      "Billable traffic (Mbps)",
-		},
+	collector.domainInfo = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "domain_info"),
+		"Domain metadata from the API, always 1",
 		[]string{
+			"client_id",
 			"domain",
+			"domain_id",
+			"status",
+			"qrator_ip",
 		},
+		nil,
 	)
-	return collector, nil
+
+	collector.domainStatus = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "domain_status"),
+		"Whether the domain is online (1) or in any other state (0)",
+		collector.domainLabels(),
+		nil,
+	)
+
+	collector.scrapeSuccess = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "domain_scrape_success"),
+		"Whether the last stats call of the domain succeeded",
+		collector.domainLabels("endpoint"),
+		nil,
+	)
+
+	collector.scrapeDuration = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "domain_scrape_duration_seconds"),
+		"Duration of the last stats call of the domain",
+		collector.domainLabels("endpoint"),
+		nil,
+	)
+
+	collector.billableTraffic = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "billable_traffic"),
+		"Billable traffic (Mbps)",
+		collector.domainLabels(),
+		nil,
+	)
+
+	collector.dnsRequestRate = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "dns_request_rate"),
+		"DNS request rate (rps)",
+		collector.domainLabels(),
+		nil,
+	)
+
+	collector.dnsResponses = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "dns_response_rate"),
+		"DNS response rate by response code (rps)",
+		collector.domainLabels("rcode"),
+		nil,
+	)
+
+	collector.upstreamInfo = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "domain_upstream_info"),
+		"Upstream of the domain from the API, always 1",
+		collector.domainLabels("ip", "weight", "backup"),
+		nil,
+	)
+
+	collector.upstreams = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "domain_upstreams"),
+		"Number of upstreams of the domain",
+		collector.domainLabels(),
+		nil,
+	)
+
+	collector.listEntries = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "domain_list_entries"),
+		"Number of entries in the domain blacklist or whitelist",
+		collector.domainLabels("list"),
+		nil,
+	)
+
+	collector.listNextExpiry = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "domain_list_next_expiry_timestamp_seconds"),
+		"Unix time the first temporary entry of the domain blacklist or whitelist expires at",
+		collector.domainLabels("list"),
+		nil,
+	)
+
+	collector.listEntryExpiry = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "domain_list_entry_expiry_timestamp_seconds"),
+		"Unix time the entry of the domain blacklist or whitelist expires at, 0 if it's permanent",
+		collector.domainLabels("list", "ip"),
+		nil,
+	)
+
+	collector.certExpiry = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "certificate_expiry_timestamp_seconds"),
+		"Unix time the TLS certificate of the domain uploaded to Qrator expires at",
+		collector.domainLabels("cert_id", "subject"),
+		nil,
+	)
+	return collector
+}
+
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.Lock()
+	snap := c.snapshot
+	c.Unlock()
+	c.collect(ch, snap)
 }
 
-func newClient(proxy string, timeout time.Duration) (*http.Client, error) {
-	if proxy == "" {
-		return &http.Client{
-			Timeout: timeout,
-		}, nil
+// collect sends the metrics of snap, which may be nil, and of the collector.
+func (c *Collector) collect(ch chan<- prometheus.Metric, snap *snapshot) {
+	if snap != nil {
+		for _, ds := range snap.domains {
+			c.collectDomain(ch, ds)
+		}
+		for a, ips := range snap.sourceIPs {
+			for _, ip := range ips {
+				ch <- prometheus.MustNewConstMetric(c.sourceIPInfo, prometheus.GaugeValue, 1, a.label, ip)
+			}
+			ch <- prometheus.MustNewConstMetric(c.sourceIPsHash, prometheus.GaugeValue, sourceIPsHash(ips), a.label)
+		}
+		for a, polled := range snap.domainsPolled {
+			ch <- prometheus.MustNewConstMetric(c.domainsPolled, prometheus.GaugeValue, float64(polled.Unix()), a.label)
+		}
+		ch <- prometheus.MustNewConstMetric(c.lastPollTimestamp, prometheus.GaugeValue, float64(snap.timestamp.Unix()))
+		ch <- prometheus.MustNewConstMetric(c.lastPollDuration, prometheus.GaugeValue, snap.duration.Seconds())
+		ch <- prometheus.MustNewConstMetric(c.snapshotAge, prometheus.GaugeValue, time.Since(snap.timestamp).Seconds())
 	}
-	proxyUrl, err := url.Parse(proxy)
-	if err != nil {
-		return nil, fmt.Errorf("error parsing proxy url: %w", err)
+
+	ch <- c.totalScrapes
+	ch <- c.failedDomainScrapes
+	ch <- c.failedDomainHTTPScrapes
+	ch <- c.failedDomainIPScrapes
+	ch <- c.failedDomainBillScrapes
+	ch <- c.failedDomainDNSScrapes
+	ch <- c.failedDomainUpstreamScrapes
+	ch <- c.failedDomainListScrapes
+	ch <- c.failedDomainCertScrapes
+	c.apiRetries.Collect(ch)
+	c.apiErrors.Collect(ch)
+	ch <- c.rateLimiterWait
+	c.apiRequestDuration.Collect(ch)
+	c.apiInFlight.Collect(ch)
+	for _, a := range c.accounts {
+		ch <- prometheus.MustNewConstMetric(c.up, prometheus.GaugeValue, boolValue(a.up.Load()), a.label)
+		ch <- prometheus.MustNewConstMetric(c.circuitState, prometheus.GaugeValue, float64(a.client.CircuitState()), a.label)
 	}
-	return &http.Client{
-		Timeout: 5 * time.Second,
-		Transport: &http.Transport{
-			Proxy: http.ProxyURL(proxyUrl),
-		},
-	}, nil
 }
 
-func (c *Collector) Collect(ch chan<- prometheus.Metric) {
-	c.Lock()
-	defer c.Unlock()
+// collectDomain sends metrics of one domain from the snapshot. Metrics of a
+// failed stats call are not sent, so no stale values are exported.
+func (c *Collector) collectDomain(ch chan<- prometheus.Metric, ds *domainSnapshot) {
+	gauge := func(desc *prometheus.Desc, value float64, extra ...string) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value, c.domainValues(ds, extra...)...)
+	}
 
-	c.totalScrapes.Inc()
-	qds, err := c.getQratorDomains()
-	if err != nil {
-		c.failedDomainScrapes.Inc()
-		c.config.logger.Errorf("error getting domains:%s", err)
+	ch <- prometheus.MustNewConstMetric(c.domainInfo, prometheus.GaugeValue, 1,
+		ds.account.label, ds.domain.Name, strconv.Itoa(ds.domain.ID), ds.domain.Status, ds.domain.QratorIP)
+	if ds.domain.Status != "" {
+		gauge(c.domainStatus, boolValue(ds.domain.Status == domainOnline))
 	}
 
-	sem := Semaphore{
-		C: make(chan struct{}, c.config.con),
+	for endpoint, result := range map[string]scrapeResult{
+		"ip":           ds.ipScrape,
+		"http":         ds.httpScrape,
+		"billable":     ds.billScrape,
+		"dns":          ds.dnsScrape,
+		"upstream":     ds.upstreamScrape,
+		"blacklist":    ds.blacklistScrape,
+		"whitelist":    ds.whitelistScrape,
+		"certificates": ds.certScrape,
+	} {
+		if result.skipped {
+			continue
+		}
+		gauge(c.scrapeSuccess, boolValue(result.success), endpoint)
+		gauge(c.scrapeDuration, result.duration.Seconds(), endpoint)
 	}
-	wg := &sync.WaitGroup{}
-	for _, qd := range qds {
-		//IPStat API
-		wg.Add(1)
-		go func(qd entity.QratorDomain, ch chan<- prometheus.Metric, wg *sync.WaitGroup) {
-			sem.Acquire()
-			defer sem.Release()
-			defer wg.Done()
-
-			iPStat, err := c.getQratorDomainIPStats(qd)
-			if err != nil {
-				c.failedDomainIPScrapes.Inc()
-				c.config.logger.Errorf("failed to get ip stats: %s", err)
-				return
-			}
 
-			c.bypassedTraffic.WithLabelValues(qd.Name).Set(float64(iPStat.Result.Bandwidth.Passed))
-			c.incomingTraffic.WithLabelValues(qd.Name).Set(float64(iPStat.Result.Bandwidth.Input))
-			c.outgoingTraffic.WithLabelValues(qd.Name).Set(float64(iPStat.Result.Bandwidth.Output))
-			c.bypassedPackets.WithLabelValues(qd.Name).Set(float64(iPStat.Result.Packets.Passed))
-			c.incomingPackets.WithLabelValues(qd.Name).Set(float64(iPStat.Result.Packets.Input))
-			c.outgoingPackets.WithLabelValues(qd.Name).Set(float64(iPStat.Result.Packets.Output))
-			c.bannedIPs.WithLabelValues(qd.Name, "Qrator").Set(float64(iPStat.Result.Blacklist.Qrator))
-			c.bannedIPs.WithLabelValues(qd.Name, "Qrator.API").Set(float64(iPStat.Result.Blacklist.API))
-			c.bannedIPs.WithLabelValues(qd.Name, "WAF").Set(float64(iPStat.Result.Blacklist.WAF))
-			c.bannedIPs.WithLabelValues(qd.Name, "Custom").Set(float64(iPStat.Result.Blacklist.Custom))
-
-			ch <- c.bypassedTraffic.WithLabelValues(qd.Name)
-			ch <- c.incomingTraffic.WithLabelValues(qd.Name)
-			ch <- c.outgoingTraffic.WithLabelValues(qd.Name)
-			ch <- c.bypassedPackets.WithLabelValues(qd.Name)
-			ch <- c.incomingPackets.WithLabelValues(qd.Name)
-			ch <- c.outgoingPackets.WithLabelValues(qd.Name)
-			ch <- c.bannedIPs.WithLabelValues(qd.Name, "Qrator")
-			ch <- c.bannedIPs.WithLabelValues(qd.Name, "Qrator.API")
-			ch <- c.bannedIPs.WithLabelValues(qd.Name, "WAF")
-			ch <- c.bannedIPs.WithLabelValues(qd.Name, "Custom")
-		}(qd, ch, wg)
-
-		//HTTP Stat API
-		wg.Add(1)
-		go func(qd entity.QratorDomain, ch chan<- prometheus.Metric, wg *sync.WaitGroup) {
-			sem.Acquire()
-			defer sem.Release()
-			defer wg.Done()
-
-			httpStat, err := c.getQratorDomainHTTPStats(qd)
-			if err != nil {
-				c.failedDomainHTTPScrapes.Inc()
-				c.config.logger.Errorf("failed to get http stats: %s", err)
-				return
-			}
+	if iPStat := ds.ip; iPStat != nil {
+		gauge(c.bypassedTraffic, float64(iPStat.Bandwidth.Passed))
+		gauge(c.incomingTraffic, float64(iPStat.Bandwidth.Input))
+		gauge(c.outgoingTraffic, float64(iPStat.Bandwidth.Output))
+		gauge(c.bypassedPackets, float64(iPStat.Packets.Passed))
+		gauge(c.incomingPackets, float64(iPStat.Packets.Input))
+		gauge(c.outgoingPackets, float64(iPStat.Packets.Output))
+		gauge(c.bannedIPs, float64(iPStat.Blacklist.Qrator), "Qrator")
+		gauge(c.bannedIPs, float64(iPStat.Blacklist.API), "Qrator.API")
+		gauge(c.bannedIPs, float64(iPStat.Blacklist.WAF), "WAF")
+		gauge(c.bannedIPs, float64(iPStat.Blacklist.Custom), "Custom")
+	}
+
+	if httpStat := ds.http; httpStat != nil {
+		gauge(c.requestRate, float64(httpStat.Requests))
+		gauge(c.slowRequestsCount, float64(httpStat.Responses.Duration0000_0200), "0.2")
+		gauge(c.slowRequestsCount, float64(httpStat.Responses.Duration0200_0500), "0.5")
+		gauge(c.slowRequestsCount, float64(httpStat.Responses.Duration0500_0700), "0.7")
+		gauge(c.slowRequestsCount, float64(httpStat.Responses.Duration0700_1000), "1.0")
+		gauge(c.slowRequestsCount, float64(httpStat.Responses.Duration1000_1500), "1.5")
+		gauge(c.slowRequestsCount, float64(httpStat.Responses.Duration1500_2000), "2.0")
+		gauge(c.slowRequestsCount, float64(httpStat.Responses.Duration2000_5000), "5.0")
+		gauge(c.slowRequestsCount, float64(httpStat.Responses.Duration5000_Inf), ">5")
+		gauge(c.errorsCount, float64(httpStat.Errors.Total), "Total")
+		gauge(c.errorsCount, float64(httpStat.Errors.Code500), "500")
+		gauge(c.errorsCount, float64(httpStat.Errors.Code501), "501")
+		gauge(c.errorsCount, float64(httpStat.Errors.Code502), "502")
+		gauge(c.errorsCount, float64(httpStat.Errors.Code503), "503")
+		gauge(c.errorsCount, float64(httpStat.Errors.Code504), "504")
+		gauge(c.errorsCount, float64(httpStat.Errors.Code4xx), "4XX")
+
+		count, buckets := responseDurationBuckets(httpStat.Responses)
+		ch <- prometheus.MustNewConstHistogram(c.responseDuration, count, 0, buckets, c.domainValues(ds)...)
+	}
+
+	if billStat := ds.bill; billStat != nil {
+		gauge(c.billableTraffic, *billStat)
+	}
 
-			c.requestRate.WithLabelValues(qd.Name).Set(float64(httpStat.Result.Requests))
-			c.slowRequestsCount.WithLabelValues(qd.Name, "0.2").Set(float64(httpStat.Result.Responses.Duration0000_0200))
-			c.slowRequestsCount.WithLabelValues(qd.Name, "0.5").Set(float64(httpStat.Result.Responses.Duration0200_0500))
-			c.slowRequestsCount.WithLabelValues(qd.Name, "0.7").Set(float64(httpStat.Result.Responses.Duration0500_0700))
-			c.slowRequestsCount.WithLabelValues(qd.Name, "1.0").Set(float64(httpStat.Result.Responses.Duration0700_1000))
-			c.slowRequestsCount.WithLabelValues(qd.Name, "1.5").Set(float64(httpStat.Result.Responses.Duration1000_1500))
-			c.slowRequestsCount.WithLabelValues(qd.Name, "2.0").Set(float64(httpStat.Result.Responses.Duration1500_2000))
-			c.slowRequestsCount.WithLabelValues(qd.Name, "5.0").Set(float64(httpStat.Result.Responses.Duration2000_5000))
-			c.slowRequestsCount.WithLabelValues(qd.Name, ">5").Set(float64(httpStat.Result.Responses.Duration5000_Inf))
-			c.errorsCount.WithLabelValues(qd.Name, "Total").Set(float64(httpStat.Result.Errors.Total))
-			c.errorsCount.WithLabelValues(qd.Name, "500").Set(float64(httpStat.Result.Errors.Code500))
-			c.errorsCount.WithLabelValues(qd.Name, "501").Set(float64(httpStat.Result.Errors.Code501))
-			c.errorsCount.WithLabelValues(qd.Name, "502").Set(float64(httpStat.Result.Errors.Code502))
-			c.errorsCount.WithLabelValues(qd.Name, "503").Set(float64(httpStat.Result.Errors.Code503))
-			c.errorsCount.WithLabelValues(qd.Name, "504").Set(float64(httpStat.Result.Errors.Code504))
-			c.errorsCount.WithLabelValues(qd.Name, "4XX").Set(float64(httpStat.Result.Errors.Code4xx))
-
-			ch <- c.requestRate.WithLabelValues(qd.Name)
-			ch <- c.slowRequestsCount.WithLabelValues(qd.Name, "0.2")
-			ch <- c.slowRequestsCount.WithLabelValues(qd.Name, "0.5")
-			ch <- c.slowRequestsCount.WithLabelValues(qd.Name, "0.7")
-			ch <- c.slowRequestsCount.WithLabelValues(qd.Name, "1.0")
-			ch <- c.slowRequestsCount.WithLabelValues(qd.Name, "1.5")
-			ch <- c.slowRequestsCount.WithLabelValues(qd.Name, "2.0")
-			ch <- c.slowRequestsCount.WithLabelValues(qd.Name, "5.0")
-			ch <- c.slowRequestsCount.WithLabelValues(qd.Name, ">5")
-			ch <- c.errorsCount.WithLabelValues(qd.Name, "Total")
-			ch <- c.errorsCount.WithLabelValues(qd.Name, "500")
-			ch <- c.errorsCount.WithLabelValues(qd.Name, "501")
-			ch <- c.errorsCount.WithLabelValues(qd.Name, "502")
-			ch <- c.errorsCount.WithLabelValues(qd.Name, "503")
-			ch <- c.errorsCount.WithLabelValues(qd.Name, "504")
-			ch <- c.errorsCount.WithLabelValues(qd.Name, "4XX")
-		}(qd, ch, wg)
-
-		// Billable API
-		wg.Add(1)
-		go func(qd entity.QratorDomain, ch chan<- prometheus.Metric, wg *sync.WaitGroup) {
-			sem.Acquire()
-			defer sem.Release()
-			defer wg.Done()
-
-			billStat, err := c.getQratorDomainBillableStats(qd)
-			if err != nil {
-				c.failedDomainBillScrapes.Inc()
-				c.config.logger.Errorf("failed to get billable stats: %s", err)
-				return
+	if ds.upstreams != nil {
+		gauge(c.upstreams, float64(len(ds.upstreams)))
+		// Equal entries would be duplicate series.
+		seen := make(map[entity.DomainUpstream]bool, len(ds.upstreams))
+		for _, u := range ds.upstreams {
+			if seen[u] {
+				continue
 			}
+			seen[u] = true
+			gauge(c.upstreamInfo, 1, u.IP, strconv.Itoa(u.Weight), strconv.FormatBool(u.Backup))
+		}
+	}
+
+	for list, entries := range map[string][]entity.ListEntry{
+		"blacklist": ds.blacklist,
+		"whitelist": ds.whitelist,
+	} {
+		if entries == nil {
+			continue
+		}
+		gauge(c.listEntries, float64(len(entries)), list)
+		top := expiringFirst(entries)
+		if len(top) > 0 && top[0].Expires > 0 {
+			gauge(c.listNextExpiry, float64(top[0].Expires), list)
+		}
+		if len(top) > c.config.listEntriesLimit {
+			top = top[:c.config.listEntriesLimit]
+		}
+		for _, e := range top {
+			gauge(c.listEntryExpiry, float64(e.Expires), list, e.IP)
+		}
+	}
 
-			c.billableTraffic.WithLabelValues(qd.Name).Set(float64(billStat.Result))
-			ch <- c.billableTraffic.WithLabelValues(qd.Name)
-		}(qd, ch, wg)
+	seenCerts := make(map[int]bool, len(ds.certificates))
+	for _, cert := range ds.certificates {
+		if cert.NotAfter.IsZero() || seenCerts[cert.ID] {
+			continue
+		}
+		seenCerts[cert.ID] = true
+		gauge(c.certExpiry, float64(cert.NotAfter.Unix()), strconv.Itoa(cert.ID), cert.Subject)
+	}
 
+	if dnsStat := ds.dns; dnsStat != nil {
+		gauge(c.dnsRequestRate, dnsStat.Requests)
+		for rcode, rate := range dnsStat.Responses {
+			gauge(c.dnsResponses, rate, rcode)
+		}
 	}
+}
 
-	wg.Wait()
-	ch <- c.totalScrapes
-	ch <- c.failedDomainScrapes
+// expiringFirst returns entries with unique IPs sorted by expiry time,
+// permanent entries last.
+func expiringFirst(entries []entity.ListEntry) []entity.ListEntry {
+	sorted := slices.Clone(entries)
+	slices.SortStableFunc(sorted, func(a, b entity.ListEntry) int {
+		switch {
+		case a.Expires == b.Expires:
+			return strings.Compare(a.IP, b.IP)
+		case a.Expires == 0:
+			return 1
+		case b.Expires == 0:
+			return -1
+		default:
+			return cmp.Compare(a.Expires, b.Expires)
+		}
+	})
+	seen := make(map[string]bool, len(sorted))
+	return slices.DeleteFunc(sorted, func(e entity.ListEntry) bool {
+		if seen[e.IP] {
+			return true
+		}
+		seen[e.IP] = true
+		return false
+	})
+}
+
+// sourceIPsHash returns a 32-bit hash of sorted ips, so the value is exact
+// in float64.
+func sourceIPsHash(ips []string) float64 {
+	h := fnv.New32a()
+	for _, ip := range ips {
+		h.Write([]byte(ip))
+		h.Write([]byte{0})
+	}
+	return float64(h.Sum32())
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// domainLabels returns label names of per-domain metrics followed by extra.
+func (c *Collector) domainLabels(extra ...string) []string {
+	labels := []string{"client_id", "domain"}
+	if !c.config.legacyLabels {
+		labels = append(labels, "domain_id")
+	}
+	return append(labels, extra...)
+}
+
+// domainValues returns label values of ds matching domainLabels.
+func (c *Collector) domainValues(ds *domainSnapshot, extra ...string) []string {
+	values := []string{ds.account.label, ds.domain.Name}
+	if !c.config.legacyLabels {
+		values = append(values, strconv.Itoa(ds.domain.ID))
+	}
+	return append(values, extra...)
+}
+
+// responseRateScale multiplies response rates before they are rounded to
+// histogram counts, so low rates don't round to 0. Quantiles don't change.
+const responseRateScale = 1000
+
+// responseDurationBuckets converts HTTP stats durations to cumulative
+// histogram buckets scaled by responseRateScale. The last bucket (>5s) only
+// adds to the count.
+func responseDurationBuckets(d entity.HTTPStatsDurations) (uint64, map[float64]uint64) {
+	bounds := []struct {
+		le    float64
+		value float64
+	}{
+		{0.2, d.Duration0000_0200},
+		{0.5, d.Duration0200_0500},
+		{0.7, d.Duration0500_0700},
+		{1.0, d.Duration0700_1000},
+		{1.5, d.Duration1000_1500},
+		{2.0, d.Duration1500_2000},
+		{5.0, d.Duration2000_5000},
+	}
+	buckets := make(map[float64]uint64, len(bounds))
+	var total float64
+	for _, b := range bounds {
+		total += b.value
+		buckets[b.le] = uint64(math.Round(total * responseRateScale))
+	}
+	total += d.Duration5000_Inf
+	return uint64(math.Round(total * responseRateScale)), buckets
 }
 
+// Describe sends the static descriptors of all metrics, it doesn't call the
+// API.
 func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
-	prometheus.DescribeByCollect(c, ch)
+	for _, desc := range []*prometheus.Desc{
+		c.bypassedTraffic,
+		c.incomingTraffic,
+		c.outgoingTraffic,
+		c.bypassedPackets,
+		c.incomingPackets,
+		c.outgoingPackets,
+		c.requestRate,
+		c.slowRequestsCount,
+		c.errorsCount,
+		c.bannedIPs,
+		c.billableTraffic,
+		c.dnsRequestRate,
+		c.dnsResponses,
+		c.upstreamInfo,
+		c.upstreams,
+		c.listEntries,
+		c.listNextExpiry,
+		c.listEntryExpiry,
+		c.certExpiry,
+		c.up,
+		c.sourceIPInfo,
+		c.sourceIPsHash,
+		c.domainInfo,
+		c.domainStatus,
+		c.scrapeSuccess,
+		c.scrapeDuration,
+		c.responseDuration,
+		c.circuitState,
+		c.domainsPolled,
+	} {
+		ch <- desc
+	}
+
+	ch <- c.totalScrapes.Desc()
+	ch <- c.failedDomainScrapes.Desc()
+	ch <- c.failedDomainHTTPScrapes.Desc()
+	ch <- c.failedDomainIPScrapes.Desc()
+	ch <- c.failedDomainBillScrapes.Desc()
+	ch <- c.failedDomainDNSScrapes.Desc()
+	ch <- c.failedDomainUpstreamScrapes.Desc()
+	ch <- c.failedDomainListScrapes.Desc()
+	ch <- c.failedDomainCertScrapes.Desc()
+	c.apiRetries.Describe(ch)
+	c.apiErrors.Describe(ch)
+	ch <- c.rateLimiterWait.Desc()
+	c.apiRequestDuration.Describe(ch)
+	c.apiInFlight.Describe(ch)
+	ch <- c.lastPollTimestamp
+	ch <- c.lastPollDuration
+	ch <- c.snapshotAge
 }
@@ -0,0 +1,65 @@
+package collector
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ezhische/qrator-exporter/qrator/entity"
+)
+
+func TestResponseDurationBuckets(t *testing.T) {
+	tests := []struct {
+		name        string
+		durations   entity.HTTPStatsDurations
+		wantCount   uint64
+		wantBuckets map[float64]uint64
+	}{
+		{
+			name:        "no responses",
+			wantCount:   0,
+			wantBuckets: map[float64]uint64{0.2: 0, 0.5: 0, 0.7: 0, 1: 0, 1.5: 0, 2: 0, 5: 0},
+		},
+		{
+			name: "cumulative and scaled",
+			durations: entity.HTTPStatsDurations{
+				Duration0000_0200: 1,
+				Duration0200_0500: 2,
+				Duration0500_0700: 3,
+				Duration0700_1000: 4,
+				Duration1000_1500: 5,
+				Duration1500_2000: 6,
+				Duration2000_5000: 7,
+				Duration5000_Inf:  8,
+			},
+			wantCount:   36000,
+			wantBuckets: map[float64]uint64{0.2: 1000, 0.5: 3000, 0.7: 6000, 1: 10000, 1.5: 15000, 2: 21000, 5: 28000},
+		},
+		{
+			name: "small rates",
+			durations: entity.HTTPStatsDurations{
+				Duration0000_0200: 0.2,
+				Duration0200_0500: 0.0004,
+				Duration0500_0700: 0.0004,
+			},
+			wantCount:   201,
+			wantBuckets: map[float64]uint64{0.2: 200, 0.5: 200, 0.7: 201, 1: 201, 1.5: 201, 2: 201, 5: 201},
+		},
+		{
+			name:        "slowest only in count",
+			durations:   entity.HTTPStatsDurations{Duration5000_Inf: 1.5},
+			wantCount:   1500,
+			wantBuckets: map[float64]uint64{0.2: 0, 0.5: 0, 0.7: 0, 1: 0, 1.5: 0, 2: 0, 5: 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			count, buckets := responseDurationBuckets(tt.durations)
+			if count != tt.wantCount {
+				t.Errorf("got count %d, want %d", count, tt.wantCount)
+			}
+			if !reflect.DeepEqual(buckets, tt.wantBuckets) {
+				t.Errorf("got buckets %v, want %v", buckets, tt.wantBuckets)
+			}
+		})
+	}
+}
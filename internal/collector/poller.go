@@ -0,0 +1,464 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/ezhische/qrator-exporter/qrator/entity"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// snapshot holds the result of one complete polling round.
+type snapshot struct {
+	domains []*domainSnapshot
+	// sourceIPs holds sorted Qrator source IPs of every account
+	sourceIPs map[*account][]string
+	// domainsPolled holds the last time the domain list of every account was
+	// fetched
+	domainsPolled map[*account]time.Time
+	timestamp     time.Time
+	duration      time.Duration
+}
+
+// domainSnapshot holds the stats fetched for a single domain. A nil field
+// means the corresponding API call failed during the round.
+type domainSnapshot struct {
+	account *account
+	domain  entity.QratorDomain
+	ip      *entity.DomainIPStatsResult
+	http    *entity.HTTPStatsResult
+	bill    *float64
+	dns     *entity.DNSStatsResult
+	// upstreams is nil if the call failed
+	upstreams []entity.DomainUpstream
+	// blacklist and whitelist are nil if the call failed
+	blacklist []entity.ListEntry
+	whitelist []entity.ListEntry
+	// certificates is nil if the call failed
+	certificates []entity.Certificate
+
+	ipScrape        scrapeResult
+	httpScrape      scrapeResult
+	billScrape      scrapeResult
+	dnsScrape       scrapeResult
+	upstreamScrape  scrapeResult
+	blacklistScrape scrapeResult
+	whitelistScrape scrapeResult
+	certScrape      scrapeResult
+}
+
+// failed returns a copy of ds without stats, with every call that applies to
+// the domain marked failed.
+func (ds *domainSnapshot) failed() *domainSnapshot {
+	return &domainSnapshot{
+		account:         ds.account,
+		domain:          ds.domain,
+		ipScrape:        ds.ipScrape.failed(),
+		httpScrape:      ds.httpScrape.failed(),
+		billScrape:      ds.billScrape.failed(),
+		dnsScrape:       ds.dnsScrape.failed(),
+		upstreamScrape:  ds.upstreamScrape.failed(),
+		blacklistScrape: ds.blacklistScrape.failed(),
+		whitelistScrape: ds.whitelistScrape.failed(),
+		certScrape:      ds.certScrape.failed(),
+	}
+}
+
+// scrapeResult is the outcome of one stats call of a domain.
+type scrapeResult struct {
+	success  bool
+	duration time.Duration
+	// skipped is set if the call doesn't apply to the domain
+	skipped bool
+}
+
+func (r scrapeResult) failed() scrapeResult {
+	return scrapeResult{skipped: r.skipped}
+}
+
+// checkRetryInterval is the delay between API checks of accounts that are
+// not ready yet.
+const checkRetryInterval = 10 * time.Second
+
+// Run polls the Qrator API every poll interval until ctx is cancelled.
+// The first round is started immediately, accounts which fail it are checked
+// again in background and polled as soon as they pass the check.
+func (c *Collector) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.config.pollInterval)
+	defer ticker.Stop()
+
+	c.Poll(ctx)
+	go c.checkAccounts(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-c.accountReady:
+		}
+		c.Poll(ctx)
+	}
+}
+
+// Ready reports whether the API has been reachable with valid credentials
+// for every account.
+func (c *Collector) Ready() bool {
+	for _, a := range c.accounts {
+		if !a.ready.Load() {
+			return false
+		}
+	}
+	return true
+}
+
+// Inherit takes over state of prev for accounts which didn't change, so a
+// reload neither makes the exporter unready nor empties /metrics until the
+// first poll: readiness is kept if the credentials are the same, the last
+// snapshot if the whole account is the same. It must be called before Run.
+func (c *Collector) Inherit(prev *Collector) {
+	prev.Lock()
+	prevSnap := prev.snapshot
+	prev.Unlock()
+
+	var snap *snapshot
+	if prevSnap != nil {
+		snap = &snapshot{
+			sourceIPs:     make(map[*account][]string, len(c.accounts)),
+			domainsPolled: make(map[*account]time.Time, len(c.accounts)),
+			timestamp:     prevSnap.timestamp,
+			duration:      prevSnap.duration,
+		}
+	}
+	for _, a := range c.accounts {
+		for _, p := range prev.accounts {
+			if !sameCredentials(a.conf, p.conf) {
+				continue
+			}
+			if p.ready.Load() {
+				a.ready.Store(true)
+			}
+			if snap == nil || !reflect.DeepEqual(a.conf, p.conf) {
+				break
+			}
+			for _, ds := range prevSnap.domains {
+				if ds.account == p {
+					seeded := *ds
+					seeded.account = a
+					snap.domains = append(snap.domains, &seeded)
+				}
+			}
+			if ips, ok := prevSnap.sourceIPs[p]; ok {
+				snap.sourceIPs[a] = ips
+			}
+			if polled, ok := prevSnap.domainsPolled[p]; ok {
+				snap.domainsPolled[a] = polled
+			}
+			break
+		}
+	}
+
+	c.Lock()
+	c.snapshot = snap
+	c.Unlock()
+}
+
+// Close closes idle API connections of a collector which is no longer used.
+func (c *Collector) Close() {
+	for _, a := range c.accounts {
+		a.httpClient.CloseIdleConnections()
+	}
+}
+
+// checkAccounts checks every account which is not ready until all of them
+// pass the check or ctx is cancelled.
+func (c *Collector) checkAccounts(ctx context.Context) {
+	for {
+		for _, a := range c.accounts {
+			if a.ready.Load() {
+				continue
+			}
+			checkCtx, cancel := context.WithTimeout(ctx, c.config.pollTimeout)
+			err := c.qratorCheck(checkCtx, a)
+			cancel()
+			if err != nil {
+				c.config.logger.Errorf("API check failed for client id %d, retrying in %v: %s", a.clientID, checkRetryInterval, err)
+			}
+		}
+		if c.Ready() {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(checkRetryInterval):
+		}
+	}
+}
+
+// setReady marks the account ready and wakes up Run if it wasn't. A poll
+// in progress is not followed by another one, the account is polled on the
+// next tick then.
+func (c *Collector) setReady(a *account) {
+	if a.ready.Swap(true) || c.polling.Load() {
+		return
+	}
+	select {
+	case c.accountReady <- struct{}{}:
+	default:
+	}
+}
+
+// Poll fetches stats for all domains of every account and swaps in the new
+// snapshot once every call has finished. If the domain list of an account
+// can't be fetched its previous domains are kept with every call failed.
+// The round is bounded by the poll timeout; calls still in flight when ctx is
+// done are cancelled and the snapshot is stored with whatever was fetched.
+func (c *Collector) Poll(ctx context.Context) {
+	c.polling.Store(true)
+	defer c.polling.Store(false)
+
+	c.Lock()
+	prev := c.snapshot
+	c.Unlock()
+
+	snap := c.poll(ctx, prev, nil)
+
+	c.Lock()
+	c.snapshot = snap
+	c.Unlock()
+}
+
+// Probe polls domains, or the configured domains of every account if it is
+// empty, into a snapshot of its own and returns a collector serving it. The
+// snapshot served by Collect is not changed, so probes may run concurrently.
+func (c *Collector) Probe(ctx context.Context, domains []int) prometheus.Collector {
+	return snapshotCollector{c, c.poll(ctx, nil, domains)}
+}
+
+// snapshotCollector serves one snapshot of the collector.
+type snapshotCollector struct {
+	c    *Collector
+	snap *snapshot
+}
+
+func (s snapshotCollector) Describe(ch chan<- *prometheus.Desc) {
+	s.c.Describe(ch)
+}
+
+func (s snapshotCollector) Collect(ch chan<- prometheus.Metric) {
+	s.c.collect(ch, s.snap)
+}
+
+// poll fetches a new snapshot of domains, see Poll. prev is used for the
+// accounts whose domain list can't be fetched and may be nil.
+func (c *Collector) poll(ctx context.Context, prev *snapshot, domains []int) *snapshot {
+	ctx, cancel := context.WithTimeout(ctx, c.config.pollTimeout)
+	defer cancel()
+
+	start := time.Now()
+	c.totalScrapes.Inc()
+
+	snap := &snapshot{
+		sourceIPs:     make(map[*account][]string, len(c.accounts)),
+		domainsPolled: make(map[*account]time.Time, len(c.accounts)),
+	}
+	sem := Semaphore{
+		C: make(chan struct{}, c.config.con),
+	}
+	wg := &sync.WaitGroup{}
+	for _, a := range c.accounts {
+		var prevIPs []string
+		if prev != nil {
+			prevIPs = prev.sourceIPs[a]
+		}
+		if ips := c.pollSourceIPs(ctx, a, prevIPs); ips != nil {
+			snap.sourceIPs[a] = ips
+		}
+
+		qds, err := c.getQratorDomains(ctx, a, domains)
+		if err != nil {
+			c.failedDomainScrapes.Inc()
+			c.config.logger.Errorf("error getting domains for client id %d:%s", a.clientID, err)
+			if prev != nil {
+				for _, ds := range prev.domains {
+					if ds.account == a {
+						snap.domains = append(snap.domains, ds.failed())
+					}
+				}
+				if polled, ok := prev.domainsPolled[a]; ok {
+					snap.domainsPolled[a] = polled
+				}
+			}
+			continue
+		}
+		snap.domainsPolled[a] = time.Now()
+
+		for _, qd := range qds {
+			ds := &domainSnapshot{account: a, domain: qd}
+			snap.domains = append(snap.domains, ds)
+			c.pollDomain(ctx, ds, &sem, wg)
+		}
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		c.config.logger.Warnf("poll was interrupted, snapshot is partial: %s", err)
+	}
+
+	snap.timestamp = time.Now()
+	snap.duration = snap.timestamp.Sub(start)
+	return snap
+}
+
+// pollSourceIPs fetches source IPs of the account and logs a change of the
+// set against prev. prev is returned if the call fails.
+func (c *Collector) pollSourceIPs(ctx context.Context, a *account, prev []string) []string {
+	ips, err := c.getQratorSourceIPs(ctx, a)
+	if err != nil {
+		c.config.logger.Errorf("error getting source ips for client id %d: %s", a.clientID, err)
+		return prev
+	}
+	if prev != nil && !slices.Equal(prev, ips) {
+		c.config.logger.Warnf("Qrator source IPs of client id %d changed, added: %v, removed: %v",
+			a.clientID, missing(ips, prev), missing(prev, ips))
+	}
+	return ips
+}
+
+// missing returns elements of sorted a which are not in sorted b.
+func missing(a, b []string) []string {
+	var diff []string
+	for _, s := range a {
+		if _, found := slices.BinarySearch(b, s); !found {
+			diff = append(diff, s)
+		}
+	}
+	return diff
+}
+
+func (c *Collector) pollDomain(ctx context.Context, ds *domainSnapshot, sem *Semaphore, wg *sync.WaitGroup) {
+	//IPStat API
+	c.scrape(ctx, sem, wg, &ds.ipScrape, c.failedDomainIPScrapes, func() error {
+		iPStat, err := c.getQratorDomainIPStats(ctx, ds.account, ds.domain)
+		if err != nil {
+			return fmt.Errorf("failed to get ip stats: %w", err)
+		}
+		ds.ip = iPStat
+		return nil
+	})
+
+	//HTTP Stat API
+	c.scrape(ctx, sem, wg, &ds.httpScrape, c.failedDomainHTTPScrapes, func() error {
+		httpStat, err := c.getQratorDomainHTTPStats(ctx, ds.account, ds.domain)
+		if err != nil {
+			return fmt.Errorf("failed to get http stats: %w", err)
+		}
+		ds.http = httpStat
+		return nil
+	})
+
+	// Billable API
+	c.scrape(ctx, sem, wg, &ds.billScrape, c.failedDomainBillScrapes, func() error {
+		billStat, err := c.getQratorDomainBillableStats(ctx, ds.account, ds.domain)
+		if err != nil {
+			return fmt.Errorf("failed to get billable stats: %w", err)
+		}
+		ds.bill = billStat
+		return nil
+	})
+
+	// Upstream API
+	if c.config.extras.Upstreams {
+		c.scrape(ctx, sem, wg, &ds.upstreamScrape, c.failedDomainUpstreamScrapes, func() error {
+			upstreams, err := c.getQratorDomainUpstreams(ctx, ds.account, ds.domain)
+			if err != nil {
+				return fmt.Errorf("failed to get upstreams: %w", err)
+			}
+			if upstreams == nil {
+				upstreams = []entity.DomainUpstream{}
+			}
+			ds.upstreams = upstreams
+			return nil
+		})
+	} else {
+		ds.upstreamScrape.skipped = true
+	}
+
+	// Blacklist and whitelist API
+	if c.config.extras.Lists {
+		c.scrape(ctx, sem, wg, &ds.blacklistScrape, c.failedDomainListScrapes, func() error {
+			entries, err := c.getQratorDomainList(ctx, ds.account, ds.domain, entity.Blacklist)
+			if err != nil {
+				return fmt.Errorf("failed to get blacklist: %w", err)
+			}
+			ds.blacklist = entries
+			return nil
+		})
+		c.scrape(ctx, sem, wg, &ds.whitelistScrape, c.failedDomainListScrapes, func() error {
+			entries, err := c.getQratorDomainList(ctx, ds.account, ds.domain, entity.Whitelist)
+			if err != nil {
+				return fmt.Errorf("failed to get whitelist: %w", err)
+			}
+			ds.whitelist = entries
+			return nil
+		})
+	} else {
+		ds.blacklistScrape.skipped = true
+		ds.whitelistScrape.skipped = true
+	}
+
+	// Certificates API
+	if c.config.extras.Certificates {
+		c.scrape(ctx, sem, wg, &ds.certScrape, c.failedDomainCertScrapes, func() error {
+			certs, err := c.getQratorDomainCertificates(ctx, ds.account, ds.domain)
+			if err != nil {
+				return fmt.Errorf("failed to get certificates: %w", err)
+			}
+			ds.certificates = certs
+			return nil
+		})
+	} else {
+		ds.certScrape.skipped = true
+	}
+
+	// DNS Stat API
+	if !ds.account.dnsDomains[ds.domain.ID] {
+		ds.dnsScrape.skipped = true
+		return
+	}
+	c.scrape(ctx, sem, wg, &ds.dnsScrape, c.failedDomainDNSScrapes, func() error {
+		dnsStat, err := c.getQratorDomainDNSStats(ctx, ds.account, ds.domain)
+		if err != nil {
+			return fmt.Errorf("failed to get dns stats: %w", err)
+		}
+		ds.dns = dnsStat
+		return nil
+	})
+}
+
+// scrape runs fetch in a goroutine limited by sem and records its outcome in
+// result.
+func (c *Collector) scrape(ctx context.Context, sem *Semaphore, wg *sync.WaitGroup, result *scrapeResult, failed prometheus.Counter, fetch func() error) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := sem.Acquire(ctx); err != nil {
+			failed.Inc()
+			return
+		}
+		defer sem.Release()
+
+		start := time.Now()
+		err := fetch()
+		result.duration = time.Since(start)
+		if err != nil {
+			failed.Inc()
+			c.config.logger.Error(err)
+			return
+		}
+		result.success = true
+	}()
+}
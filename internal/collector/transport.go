@@ -0,0 +1,47 @@
+package collector
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ezhische/qrator-exporter/qrator"
+)
+
+// transport exports latency and in-flight count of API requests per method.
+type transport struct {
+	next http.RoundTripper
+	c    *Collector
+}
+
+func (c *Collector) instrument(client *http.Client) {
+	next := client.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	client.Transport = transport{next, c}
+}
+
+// CloseIdleConnections closes idle connections of the account's own
+// transport, the shared default one is left alone.
+func (t transport) CloseIdleConnections() {
+	if closer, ok := t.next.(interface{ CloseIdleConnections() }); ok && t.next != http.DefaultTransport {
+		closer.CloseIdleConnections()
+	}
+}
+
+func (t transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	methodClass, method, _ := qrator.MethodFromContext(r.Context())
+	inFlight := t.c.apiInFlight.WithLabelValues(methodClass.String(), method.String())
+	inFlight.Inc()
+	defer inFlight.Dec()
+
+	start := time.Now()
+	response, err := t.next.RoundTrip(r)
+	status := "error"
+	if err == nil {
+		status = strconv.Itoa(response.StatusCode)
+	}
+	t.c.apiRequestDuration.WithLabelValues(methodClass.String(), method.String(), status).Observe(time.Since(start).Seconds())
+	return response, err
+}
@@ -0,0 +1,36 @@
+package config
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Client is a named Qrator credential set from the config or clients file.
+type Client struct {
+	ClientID     int    `yaml:"client_id"`
+	APIToken     string `yaml:"token"`
+	APITokenFile string `yaml:"token_file"`
+	IPAuth       bool   `yaml:"ip_auth"`
+	APIURL       string `yaml:"api_url"`
+	ProxyURL     string `yaml:"proxy_url"`
+	Domains      []int  `yaml:"domains"`
+	DNSDomains   []int  `yaml:"dns_domains"`
+}
+
+type clientsFile struct {
+	Clients map[string]Client `yaml:"clients"`
+}
+
+func ClientsFromFile(path string) (map[string]Client, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("can't read clients file: %w", err)
+	}
+	file := clientsFile{}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("can't parse clients file %s: %w", path, err)
+	}
+	return file.Clients, nil
+}
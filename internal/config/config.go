@@ -1,41 +1,233 @@
 package config
 
 import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
 	"time"
 
 	env "github.com/caarlos0/env/v9"
 	"github.com/ezhische/qrator-exporter/internal/collector"
+	"github.com/ezhische/qrator-exporter/qrator"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
 )
 
+type Retry struct {
+	MaxRetries     int           `env:"QRATOR_RETRY_MAX" envDefault:"3" yaml:"max_retries"`
+	InitialBackoff time.Duration `env:"QRATOR_RETRY_BACKOFF" envDefault:"200ms" yaml:"initial_backoff"`
+	MaxBackoff     time.Duration `env:"QRATOR_RETRY_MAX_BACKOFF" envDefault:"5s" yaml:"max_backoff"`
+	Budget         time.Duration `env:"QRATOR_RETRY_BUDGET" envDefault:"15s" yaml:"budget"`
+}
+
+type Breaker struct {
+	Failures    int           `env:"QRATOR_CIRCUIT_FAILURES" envDefault:"5" yaml:"failures"`
+	OpenTimeout time.Duration `env:"QRATOR_CIRCUIT_OPEN_TIMEOUT" envDefault:"30s" yaml:"open_timeout"`
+}
+
 type Config struct {
-	APIToken  string        `env:"QRATOR_X_QRATOR_AUTH,required"`
-	APIURL    string        `env:"QRATOR_API_URL" envDefault:"https://api.qrator.net/request"`
-	ClientID  int           `env:"QRATOR_CLIENT_ID,required"`
-	Domains   []int         `env:"QRATOR_DOMAINS_IDS" envSeparator:","`
-	ProxyURL  string        `env:"QRATOR_PROXY_URL"`
-	Timeout   time.Duration `env:"QRATOR_TIMEOUT" envDefault:"5s"`
-	Port      int           `env:"QRATOR_EXPORTER_PORT" envDefault:"9502"`
-	Concurent int           `env:"QRATOR_EXPORTER_CONCURENT" envDefault:"10"`
+	APIToken            string        `env:"QRATOR_X_QRATOR_AUTH" yaml:"token"`
+	TokenFile           string        `env:"QRATOR_X_QRATOR_AUTH_FILE" yaml:"token_file"`
+	IPAuth              bool          `env:"QRATOR_IP_AUTH" yaml:"ip_auth"`
+	APIURL              string        `env:"QRATOR_API_URL" envDefault:"https://api.qrator.net/request" yaml:"api_url"`
+	ClientID            int           `env:"QRATOR_CLIENT_ID" yaml:"client_id"`
+	Domains             []int         `env:"QRATOR_DOMAINS_IDS" envSeparator:"," yaml:"domains"`
+	ProxyURL            string        `env:"QRATOR_PROXY_URL" yaml:"proxy_url"`
+	Timeout             time.Duration `env:"QRATOR_TIMEOUT" envDefault:"5s" yaml:"timeout"`
+	Port                int           `env:"QRATOR_EXPORTER_PORT" envDefault:"9502" yaml:"port"`
+	Concurent           int           `env:"QRATOR_EXPORTER_CONCURENT" envDefault:"10" yaml:"concurrency"`
+	Interval            time.Duration `env:"QRATOR_POLL_INTERVAL" envDefault:"60s" yaml:"poll_interval"`
+	PollTimeout         time.Duration `env:"QRATOR_POLL_TIMEOUT" yaml:"poll_timeout"`
+	ClientsFile         string        `env:"QRATOR_CLIENTS_FILE" yaml:"clients_file"`
+	PollClients         bool          `env:"QRATOR_POLL_CLIENTS" yaml:"poll_clients"`
+	RateLimit           float64       `env:"QRATOR_RATE_LIMIT" yaml:"rate_limit"`
+	RateBurst           int           `env:"QRATOR_RATE_BURST" envDefault:"10" yaml:"rate_burst"`
+	LegacyLabels        bool          `env:"QRATOR_LEGACY_LABELS" yaml:"legacy_labels"`
+	ListEntriesLimit    int           `env:"QRATOR_LIST_ENTRIES_LIMIT" yaml:"list_entries_limit"`
+	DNSDomains          []int         `env:"QRATOR_DNS_DOMAINS_IDS" envSeparator:"," yaml:"dns_domains"`
+	CollectUpstreams    bool          `env:"QRATOR_COLLECT_UPSTREAMS" yaml:"collect_upstreams"`
+	CollectLists        bool          `env:"QRATOR_COLLECT_LISTS" yaml:"collect_lists"`
+	CollectCertificates bool          `env:"QRATOR_COLLECT_CERTIFICATES" yaml:"collect_certificates"`
+
+	Retry   Retry             `yaml:"retry"`
+	Breaker Breaker           `yaml:"circuit_breaker"`
+	Clients map[string]Client `yaml:"clients"`
+
+	// limiter is shared by the background collector and all probes
+	limiter *rate.Limiter
 }
 
-func ConfigFromEnv() (*Config, error) {
+// Load reads configuration from the YAML file, if path is not empty, and
+// from environment variables which override values from the file.
+func Load(path string) (*Config, error) {
 	config := &Config{}
-	if err := env.Parse(config); err != nil {
+	// Defaults only, environment is applied after the file.
+	if err := env.ParseWithOptions(config, env.Options{Environment: map[string]string{}}); err != nil {
+		return nil, err
+	}
+	if path != "" {
+		if err := config.readFile(path); err != nil {
+			return nil, err
+		}
+	}
+	if err := config.overrideFromEnv(); err != nil {
+		return nil, err
+	}
+	if config.ClientsFile != "" {
+		clients, err := ClientsFromFile(config.ClientsFile)
+		if err != nil {
+			return nil, err
+		}
+		if config.Clients == nil {
+			config.Clients = make(map[string]Client, len(clients))
+		}
+		for name, client := range clients {
+			if _, ok := config.Clients[name]; ok {
+				return nil, fmt.Errorf("client %q is defined both in config file and in %s", name, config.ClientsFile)
+			}
+			config.Clients[name] = client
+		}
+	}
+	if err := config.validate(); err != nil {
 		return nil, err
 	}
+	if config.RateLimit > 0 {
+		config.limiter = rate.NewLimiter(rate.Limit(config.RateLimit), config.RateBurst)
+	}
 	return config, nil
 }
 
+// Accounts returns client accounts polled in background: the one from
+// environment and, if PollClients is set, every client from the clients file.
+func (config *Config) Accounts() []collector.Account {
+	var accounts []collector.Account
+	if config.ClientID != 0 {
+		accounts = append(accounts, collector.Account{
+			APIKey:     config.APIToken,
+			APIKeyFile: config.TokenFile,
+			ClientID:   config.ClientID,
+			APIURL:     config.APIURL,
+			Domains:    uniqueIDs(config.Domains),
+			ProxyURL:   config.ProxyURL,
+			DNSDomains: config.DNSDomains,
+		})
+	}
+	if config.PollClients {
+		for _, name := range config.clientNames() {
+			accounts = append(accounts, config.account(config.Clients[name]))
+		}
+	}
+	return accounts
+}
+
+// Equal reports whether config and other have the same settings.
+func (config *Config) Equal(other *Config) bool {
+	a, b := *config, *other
+	a.limiter, b.limiter = nil, nil
+	return reflect.DeepEqual(a, b)
+}
+
+// clientNames returns sorted names of Clients.
+func (config *Config) clientNames() []string {
+	names := make([]string, 0, len(config.Clients))
+	for name := range config.Clients {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// uniqueIDs returns ids without repeated values, keeping their order.
+func uniqueIDs(ids []int) []int {
+	seen := make(map[int]bool, len(ids))
+	var unique []int
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
+
+func (config *Config) account(client Client) collector.Account {
+	apiURL := client.APIURL
+	if apiURL == "" {
+		apiURL = config.APIURL
+	}
+	proxyURL := client.ProxyURL
+	if proxyURL == "" {
+		proxyURL = config.ProxyURL
+	}
+	return collector.Account{
+		APIKey:     client.APIToken,
+		APIKeyFile: client.APITokenFile,
+		ClientID:   client.ClientID,
+		APIURL:     apiURL,
+		Domains:    uniqueIDs(client.Domains),
+		ProxyURL:   proxyURL,
+		DNSDomains: client.DNSDomains,
+	}
+}
+
+// extras returns the optional per-domain API calls.
+func (config *Config) extras() collector.Extras {
+	return collector.Extras{
+		Upstreams:    config.CollectUpstreams,
+		Lists:        config.CollectLists,
+		Certificates: config.CollectCertificates,
+	}
+}
+
+// clientOptions returns API client options shared by all accounts.
+func (config *Config) clientOptions() []qrator.Option {
+	opts := []qrator.Option{
+		qrator.WithRetry(qrator.RetryPolicy(config.Retry)),
+		qrator.WithBreaker(qrator.BreakerSettings(config.Breaker)),
+	}
+	if config.limiter != nil {
+		opts = append(opts, qrator.WithRateLimiter(config.limiter))
+	}
+	return opts
+}
+
 func CollectorFromConfig(config *Config, logger *logrus.Logger) (*collector.Collector, error) {
 	return collector.CollectorFromConfig(
-		config.APIToken,
-		config.ClientID,
-		config.APIURL,
-		config.Domains,
-		config.ProxyURL,
+		config.Accounts(),
+		config.Timeout,
+		logger,
+		config.Concurent,
+		config.Interval,
+		config.PollTimeout,
+		config.LegacyLabels,
+		config.ListEntriesLimit,
+		config.extras(),
+		config.clientOptions()...,
+	)
+}
+
+// ErrUnknownClient is returned by ProbeCollector for a client which is not
+// configured.
+var ErrUnknownClient = errors.New("unknown client")
+
+// ProbeCollector creates a collector for the named client from the clients
+// file.
+func ProbeCollector(config *Config, name string, logger *logrus.Logger) (*collector.Collector, error) {
+	client, ok := config.Clients[name]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownClient, name)
+	}
+	return collector.CollectorFromConfig(
+		[]collector.Account{config.account(client)},
 		config.Timeout,
 		logger,
 		config.Concurent,
+		config.Interval,
+		config.PollTimeout,
+		config.LegacyLabels,
+		config.ListEntriesLimit,
+		config.extras(),
+		config.clientOptions()...,
 	)
 }
@@ -0,0 +1,134 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+
+	env "github.com/caarlos0/env/v9"
+	"gopkg.in/yaml.v3"
+)
+
+func (config *Config) readFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("can't read config file: %w", err)
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(config); err != nil {
+		return fmt.Errorf("can't parse config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// overrideFromEnv sets fields whose environment variables are set, keeping
+// values from the config file for the rest.
+func (config *Config) overrideFromEnv() error {
+	fromEnv := &Config{}
+	set := map[string]bool{}
+	err := env.ParseWithOptions(fromEnv, env.Options{
+		OnSet: func(tag string, _ interface{}, isDefault bool) {
+			if _, ok := os.LookupEnv(tag); ok && !isDefault {
+				set[tag] = true
+			}
+		},
+	})
+	if err != nil {
+		return err
+	}
+	copyEnvFields(reflect.ValueOf(config).Elem(), reflect.ValueOf(fromEnv).Elem(), set)
+	return nil
+}
+
+func copyEnvFields(dst, src reflect.Value, set map[string]bool) {
+	for i := 0; i < dst.NumField(); i++ {
+		field := dst.Type().Field(i)
+		key, _, _ := strings.Cut(field.Tag.Get("env"), ",")
+		switch {
+		case key != "":
+			if set[key] {
+				dst.Field(i).Set(src.Field(i))
+			}
+		case field.Type.Kind() == reflect.Struct && field.IsExported():
+			copyEnvFields(dst.Field(i), src.Field(i), set)
+		}
+	}
+}
+
+func (config *Config) validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(config.ClientID != 0 || len(config.Clients) > 0,
+		"client_id (QRATOR_CLIENT_ID) is required unless clients are configured")
+	check(config.APIToken == "" || config.TokenFile == "",
+		"only one of token (QRATOR_X_QRATOR_AUTH) and token_file (QRATOR_X_QRATOR_AUTH_FILE) can be set")
+	check(config.ClientID == 0 || config.IPAuth || config.APIToken != "" || config.TokenFile != "",
+		"token (QRATOR_X_QRATOR_AUTH) or token_file (QRATOR_X_QRATOR_AUTH_FILE) is required with client_id unless ip_auth (QRATOR_IP_AUTH) is set")
+	check(!config.IPAuth || config.APIToken == "" && config.TokenFile == "",
+		"ip_auth (QRATOR_IP_AUTH) can't be used with token or token_file")
+	check(!config.PollClients || len(config.Clients) > 0,
+		"poll_clients (QRATOR_POLL_CLIENTS) requires clients")
+	check(config.APIURL != "", "api_url (QRATOR_API_URL) must not be empty")
+	check(config.APIURL == "" || validURL(config.APIURL), "api_url (QRATOR_API_URL) must be an absolute URL")
+	check(config.ProxyURL == "" || validURL(config.ProxyURL), "proxy_url (QRATOR_PROXY_URL) must be an absolute URL")
+	check(config.Timeout > 0, "timeout (QRATOR_TIMEOUT) must be positive, got %v", config.Timeout)
+	check(config.Port > 0 && config.Port < 65536, "port (QRATOR_EXPORTER_PORT) must be in 1-65535, got %d", config.Port)
+	check(config.Concurent > 0, "concurrency (QRATOR_EXPORTER_CONCURENT) must be positive, got %d", config.Concurent)
+	check(config.Interval > 0, "poll_interval (QRATOR_POLL_INTERVAL) must be positive, got %v", config.Interval)
+	check(config.PollTimeout >= 0, "poll_timeout (QRATOR_POLL_TIMEOUT) must not be negative, got %v", config.PollTimeout)
+	check(config.RateLimit >= 0, "rate_limit (QRATOR_RATE_LIMIT) must not be negative, got %v", config.RateLimit)
+	check(config.RateLimit == 0 || config.RateBurst > 0,
+		"rate_burst (QRATOR_RATE_BURST) must be at least 1, got %d", config.RateBurst)
+	check(config.ListEntriesLimit >= 0, "list_entries_limit (QRATOR_LIST_ENTRIES_LIMIT) must not be negative, got %d", config.ListEntriesLimit)
+	check(config.ListEntriesLimit == 0 || config.CollectLists,
+		"list_entries_limit (QRATOR_LIST_ENTRIES_LIMIT) requires collect_lists (QRATOR_COLLECT_LISTS)")
+	check(config.Retry.MaxRetries >= 0, "retry.max_retries (QRATOR_RETRY_MAX) must not be negative, got %d", config.Retry.MaxRetries)
+	check(config.Breaker.Failures >= 0, "circuit_breaker.failures (QRATOR_CIRCUIT_FAILURES) must not be negative, got %d", config.Breaker.Failures)
+	if config.PollClients {
+		// Accounts with the same client_id would export duplicate series.
+		used := map[int]string{}
+		if config.ClientID != 0 {
+			used[config.ClientID] = "client_id (QRATOR_CLIENT_ID)"
+		}
+		for _, name := range config.clientNames() {
+			id := config.Clients[name].ClientID
+			other, ok := used[id]
+			check(!ok, "clients.%s: client_id %d is already used by %s", name, id, other)
+			used[id] = "clients." + name
+		}
+	}
+	for _, name := range config.clientNames() {
+		client := config.Clients[name]
+		check(client.ClientID != 0, "clients.%s: client_id is required", name)
+		check(client.APIToken == "" || client.APITokenFile == "",
+			"clients.%s: only one of token and token_file can be set", name)
+		check(client.IPAuth || client.APIToken != "" || client.APITokenFile != "",
+			"clients.%s: token or token_file is required unless ip_auth is set", name)
+		check(!client.IPAuth || client.APIToken == "" && client.APITokenFile == "",
+			"clients.%s: ip_auth can't be used with token or token_file", name)
+		check(client.APIURL == "" || validURL(client.APIURL), "clients.%s: api_url must be an absolute URL", name)
+		check(client.ProxyURL == "" || validURL(client.ProxyURL), "clients.%s: proxy_url must be an absolute URL", name)
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// validURL reports whether s parses as a URL with scheme and host. The value
+// isn't put into errors, URLs may hold credentials.
+func validURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && u.Scheme != "" && u.Host != ""
+}
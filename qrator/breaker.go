@@ -0,0 +1,110 @@
+package qrator
+
+import (
+	"sync"
+	"time"
+)
+
+// BreakerSettings configures the circuit breaker of a Client.
+type BreakerSettings struct {
+	// Failures is the number of consecutive failed requests which opens the
+	// circuit. Zero disables the breaker.
+	Failures int
+	// OpenTimeout is how long the circuit stays open before a probe request
+	// is let through.
+	OpenTimeout time.Duration
+}
+
+// CircuitState is the state of the circuit breaker.
+type CircuitState int
+
+const (
+	CircuitClosed CircuitState = iota
+	CircuitHalfOpen
+	CircuitOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitHalfOpen:
+		return "half-open"
+	case CircuitOpen:
+		return "open"
+	default:
+		return "closed"
+	}
+}
+
+type breaker struct {
+	settings BreakerSettings
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	// probing is set while the single half-open request is in flight
+	probing bool
+	sync.Mutex
+}
+
+// allow returns ErrCircuitOpen if the request must not be sent.
+func (b *breaker) allow() error {
+	if b.settings.Failures <= 0 {
+		return nil
+	}
+	b.Lock()
+	defer b.Unlock()
+
+	switch b.state {
+	case CircuitOpen:
+		if time.Since(b.openedAt) < b.settings.OpenTimeout {
+			return ErrCircuitOpen
+		}
+		b.state = CircuitHalfOpen
+		b.probing = true
+		return nil
+	case CircuitHalfOpen:
+		if b.probing {
+			return ErrCircuitOpen
+		}
+		b.probing = true
+		return nil
+	}
+	return nil
+}
+
+// record reports the result of an allowed request and returns the new state
+// if it has changed.
+func (b *breaker) record(success bool) (CircuitState, bool) {
+	if b.settings.Failures <= 0 {
+		return CircuitClosed, false
+	}
+	b.Lock()
+	defer b.Unlock()
+
+	prev := b.state
+	b.probing = false
+	if success {
+		b.failures = 0
+		b.state = CircuitClosed
+	} else {
+		b.failures++
+		if b.state == CircuitHalfOpen || b.failures >= b.settings.Failures {
+			b.state = CircuitOpen
+			b.openedAt = time.Now()
+		}
+	}
+	return b.state, b.state != prev
+}
+
+// abort releases an allowed request whose outcome says nothing about the API,
+// e.g. cancelled by the caller.
+func (b *breaker) abort() {
+	b.Lock()
+	defer b.Unlock()
+	b.probing = false
+}
+
+func (b *breaker) current() CircuitState {
+	b.Lock()
+	defer b.Unlock()
+	return b.state
+}
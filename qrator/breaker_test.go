@@ -0,0 +1,147 @@
+package qrator
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	// step is an action on the breaker and the state expected after it.
+	// allow expects wantErr, the other actions don't return errors.
+	type step struct {
+		action    string
+		wantErr   error
+		wantState CircuitState
+	}
+	settings := BreakerSettings{Failures: 2, OpenTimeout: time.Minute}
+
+	tests := []struct {
+		name     string
+		settings BreakerSettings
+		steps    []step
+	}{
+		{
+			name:     "disabled",
+			settings: BreakerSettings{},
+			steps: []step{
+				{action: "failure", wantState: CircuitClosed},
+				{action: "failure", wantState: CircuitClosed},
+				{action: "failure", wantState: CircuitClosed},
+				{action: "allow", wantState: CircuitClosed},
+			},
+		},
+		{
+			name:     "opens after consecutive failures",
+			settings: settings,
+			steps: []step{
+				{action: "failure", wantState: CircuitClosed},
+				{action: "allow", wantState: CircuitClosed},
+				{action: "failure", wantState: CircuitOpen},
+				{action: "allow", wantErr: ErrCircuitOpen, wantState: CircuitOpen},
+			},
+		},
+		{
+			name:     "success resets failures",
+			settings: settings,
+			steps: []step{
+				{action: "failure", wantState: CircuitClosed},
+				{action: "success", wantState: CircuitClosed},
+				{action: "failure", wantState: CircuitClosed},
+				{action: "allow", wantState: CircuitClosed},
+			},
+		},
+		{
+			name:     "half-open lets a single probe through",
+			settings: settings,
+			steps: []step{
+				{action: "failure", wantState: CircuitClosed},
+				{action: "failure", wantState: CircuitOpen},
+				{action: "timeout", wantState: CircuitOpen},
+				{action: "allow", wantState: CircuitHalfOpen},
+				{action: "allow", wantErr: ErrCircuitOpen, wantState: CircuitHalfOpen},
+				{action: "allow", wantErr: ErrCircuitOpen, wantState: CircuitHalfOpen},
+			},
+		},
+		{
+			name:     "successful probe closes",
+			settings: settings,
+			steps: []step{
+				{action: "failure", wantState: CircuitClosed},
+				{action: "failure", wantState: CircuitOpen},
+				{action: "timeout", wantState: CircuitOpen},
+				{action: "allow", wantState: CircuitHalfOpen},
+				{action: "success", wantState: CircuitClosed},
+				{action: "allow", wantState: CircuitClosed},
+				{action: "allow", wantState: CircuitClosed},
+			},
+		},
+		{
+			name:     "failed probe opens again",
+			settings: settings,
+			steps: []step{
+				{action: "failure", wantState: CircuitClosed},
+				{action: "failure", wantState: CircuitOpen},
+				{action: "timeout", wantState: CircuitOpen},
+				{action: "allow", wantState: CircuitHalfOpen},
+				{action: "failure", wantState: CircuitOpen},
+				{action: "allow", wantErr: ErrCircuitOpen, wantState: CircuitOpen},
+			},
+		},
+		{
+			name:     "aborted probe releases half-open",
+			settings: settings,
+			steps: []step{
+				{action: "failure", wantState: CircuitClosed},
+				{action: "failure", wantState: CircuitOpen},
+				{action: "timeout", wantState: CircuitOpen},
+				{action: "allow", wantState: CircuitHalfOpen},
+				{action: "abort", wantState: CircuitHalfOpen},
+				{action: "allow", wantState: CircuitHalfOpen},
+				{action: "allow", wantErr: ErrCircuitOpen, wantState: CircuitHalfOpen},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &breaker{settings: tt.settings}
+			for i, s := range tt.steps {
+				var err error
+				switch s.action {
+				case "allow":
+					err = b.allow()
+				case "success":
+					b.record(true)
+				case "failure":
+					b.record(false)
+				case "abort":
+					b.abort()
+				case "timeout":
+					b.openedAt = b.openedAt.Add(-tt.settings.OpenTimeout)
+				default:
+					t.Fatalf("step %d: unknown action %q", i, s.action)
+				}
+				if !errors.Is(err, s.wantErr) {
+					t.Errorf("step %d %s: got error %v, want %v", i, s.action, err, s.wantErr)
+				}
+				if state := b.current(); state != s.wantState {
+					t.Errorf("step %d %s: got state %s, want %s", i, s.action, state, s.wantState)
+				}
+			}
+		})
+	}
+}
+
+func TestBreakerRecordReportsChanges(t *testing.T) {
+	b := &breaker{settings: BreakerSettings{Failures: 1, OpenTimeout: time.Minute}}
+	if state, changed := b.record(false); state != CircuitOpen || !changed {
+		t.Errorf("first failure: got %s, %v, want open, true", state, changed)
+	}
+	if state, changed := b.record(false); state != CircuitOpen || changed {
+		t.Errorf("second failure: got %s, %v, want open, false", state, changed)
+	}
+	if state, changed := b.record(true); state != CircuitClosed || !changed {
+		t.Errorf("success: got %s, %v, want closed, true", state, changed)
+	}
+}
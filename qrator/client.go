@@ -0,0 +1,312 @@
+// Package qrator is a client for the Qrator JSON-RPC API.
+package qrator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ezhische/qrator-exporter/qrator/entity"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
+)
+
+const DefaultBaseURL = "https://api.qrator.net/request"
+
+// Observer receives events of the request layer, e.g. to export them as
+// metrics.
+type Observer interface {
+	// Retry is called before a request of method is retried.
+	Retry(method entity.APIMethod)
+	// RateLimiterWait is called with the time a request waited on the rate
+	// limiter.
+	RateLimiterWait(d time.Duration)
+	// Success is called for every successful API call.
+	Success(method entity.APIMethod)
+	// Error is called for every failed API call.
+	Error(err *APIError)
+}
+
+type Client struct {
+	httpClient *http.Client
+	baseURL    string
+	token      TokenSource
+	logger     *logrus.Logger
+	retry      RetryPolicy
+	breaker    *breaker
+	limiter    *rate.Limiter
+	observer   Observer
+}
+
+type Option func(*Client)
+
+// WithHTTPClient sets the HTTP client, see NewHTTPClient.
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = client
+	}
+}
+
+// WithAuth sets the X-Qrator-Auth token. It may be omitted with IP auth.
+func WithAuth(token string) Option {
+	return func(c *Client) {
+		c.token = staticToken(token)
+	}
+}
+
+// WithTokenSource sets the source of the X-Qrator-Auth token, e.g.
+// FileToken.
+func WithTokenSource(source TokenSource) Option {
+	return func(c *Client) {
+		c.token = source
+	}
+}
+
+// WithBaseURL sets the API URL, DefaultBaseURL by default.
+func WithBaseURL(baseURL string) Option {
+	return func(c *Client) {
+		c.baseURL = baseURL
+	}
+}
+
+func WithLogger(logger *logrus.Logger) Option {
+	return func(c *Client) {
+		c.logger = logger
+	}
+}
+
+// WithRetry enables retries of network errors, 5xx and 429 responses.
+func WithRetry(policy RetryPolicy) Option {
+	return func(c *Client) {
+		c.retry = policy
+	}
+}
+
+// WithBreaker enables the circuit breaker.
+func WithBreaker(settings BreakerSettings) Option {
+	return func(c *Client) {
+		c.breaker = &breaker{settings: settings}
+	}
+}
+
+// WithRateLimiter makes every request wait on limiter. The limiter may be
+// shared by several clients.
+func WithRateLimiter(limiter *rate.Limiter) Option {
+	return func(c *Client) {
+		c.limiter = limiter
+	}
+}
+
+func WithObserver(observer Observer) Option {
+	return func(c *Client) {
+		c.observer = observer
+	}
+}
+
+func New(opts ...Option) *Client {
+	c := &Client{
+		httpClient: http.DefaultClient,
+		baseURL:    DefaultBaseURL,
+		logger:     logrus.StandardLogger(),
+		token:      staticToken(""),
+		breaker:    &breaker{},
+		observer:   nopObserver{},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// NewHTTPClient returns an HTTP client with timeout which uses proxy if it
+// is not empty.
+func NewHTTPClient(proxy string, timeout time.Duration) (*http.Client, error) {
+	if proxy == "" {
+		return &http.Client{
+			Timeout: timeout,
+		}, nil
+	}
+	proxyUrl, err := url.Parse(proxy)
+	if err != nil {
+		// url.Error quotes the whole URL, credentials included.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return nil, fmt.Errorf("error parsing proxy url: %w", err)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyURL(proxyUrl)
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+	}, nil
+}
+
+// CircuitState returns the current state of the circuit breaker.
+func (c *Client) CircuitState() CircuitState {
+	return c.breaker.current()
+}
+
+// Post sends method to the methodClass endpoint of id and returns the raw
+// response. The caller must close the response body.
+func (c *Client) Post(ctx context.Context, methodClass entity.MethodClass, id int, method entity.APIMethod) (*http.Response, error) {
+	ctx = withMethod(ctx, methodClass, method)
+	reqURL := fmt.Sprintf("%s/%s/%d", c.baseURL, methodClass.String(), id)
+	reqBody := entity.QratorRequest{
+		Method: method.String(),
+		ID:     1,
+	}
+	body, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling request: %w", err)
+	}
+
+	token, err := c.token.Token()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrToken, err)
+	}
+	if err := c.breaker.allow(); err != nil {
+		return nil, err
+	}
+	response, err := c.retryRequest(ctx, reqURL, token, body, methodClass, method)
+	// Neither cancelled nor rate limited requests say anything about the API.
+	if ctx.Err() != nil || errors.Is(err, ErrRateLimited) {
+		c.breaker.abort()
+	} else if state, changed := c.breaker.record(err == nil && !retryable(response, nil)); changed {
+		c.logger.Warnf("circuit breaker for %s is %s", c.baseURL, state)
+	}
+	return response, err
+}
+
+// call posts method and decodes the result into result. Every failure is
+// returned as *APIError.
+func (c *Client) call(ctx context.Context, methodClass entity.MethodClass, id int, method entity.APIMethod, result any) error {
+	apiErr := &APIError{
+		MethodClass: methodClass,
+		Method:      method,
+		ID:          id,
+	}
+	fail := func(class ErrorClass, err error) error {
+		apiErr.Class = class
+		apiErr.Err = err
+		c.observer.Error(apiErr)
+		return apiErr
+	}
+
+	r, err := c.Post(ctx, methodClass, id, method)
+	if err != nil {
+		return fail(transportErrorClass(ctx, err), err)
+	}
+	defer r.Body.Close()
+	apiErr.StatusCode = r.StatusCode
+	if r.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(r.Body, maxErrorBody))
+		apiErr.Message = strings.TrimSpace(string(body))
+		return fail(ClassHTTP, nil)
+	}
+
+	response := entity.QratorResponse{}
+	if err := json.NewDecoder(r.Body).Decode(&response); err != nil {
+		return fail(ClassDecode, err)
+	}
+	if len(response.Error) > 0 && string(response.Error) != "null" {
+		var message string
+		if err := json.Unmarshal(response.Error, &message); err != nil {
+			message = string(response.Error)
+		}
+		apiErr.Message = message
+		return fail(ClassAPI, nil)
+	}
+	if err := json.Unmarshal(response.Result, result); err != nil {
+		return fail(ClassDecode, err)
+	}
+	c.observer.Success(method)
+	return nil
+}
+
+// maxErrorBody limits how much of a non-200 response is kept in APIError.
+const maxErrorBody = 512
+
+func transportErrorClass(ctx context.Context, err error) ErrorClass {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, ErrCircuitOpen):
+		return ClassCircuitOpen
+	case errors.Is(err, ErrToken):
+		return ClassAuth
+	case ctx.Err() != nil:
+		return ClassTimeout
+	case errors.Is(err, ErrRateLimited):
+		return ClassRateLimited
+	case errors.Is(err, context.DeadlineExceeded):
+		return ClassTimeout
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return ClassTimeout
+	default:
+		return ClassNetwork
+	}
+}
+
+func (c *Client) retryRequest(ctx context.Context, reqURL, token string, body []byte, methodClass entity.MethodClass, method entity.APIMethod) (*http.Response, error) {
+	deadline := time.Now().Add(c.retry.Budget)
+	for attempt := 0; ; attempt++ {
+		response, err := c.doRequest(ctx, reqURL, token, body)
+		if ctx.Err() == nil && !errors.Is(err, ErrRateLimited) && attempt < c.retry.MaxRetries && retryable(response, err) {
+			delay := c.retry.backoff(attempt, response)
+			if !time.Now().Add(delay).After(deadline) {
+				if err != nil {
+					c.logger.Debugf("%s %s failed, retrying in %v: %v", methodClass, method, delay, err)
+				} else {
+					c.logger.Debugf("%s %s returned %s, retrying in %v", methodClass, method, response.Status, delay)
+					response.Body.Close()
+				}
+				c.observer.Retry(method)
+				if err := sleep(ctx, delay); err == nil {
+					continue
+				}
+				return nil, fmt.Errorf("error making new request: %w", ctx.Err())
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error making new request: %w", err)
+		}
+		return response, nil
+	}
+}
+
+func (c *Client) doRequest(ctx context.Context, reqURL, token string, body []byte) (*http.Response, error) {
+	if c.limiter != nil {
+		start := time.Now()
+		err := c.limiter.Wait(ctx)
+		c.observer.RateLimiterWait(time.Since(start))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrRateLimited, err)
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, reqURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("cannot create new request: %w", err)
+	}
+	req.Header.Add("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Add("X-Qrator-Auth", token)
+	}
+
+	return c.httpClient.Do(req)
+}
+
+type nopObserver struct{}
+
+func (nopObserver) Retry(entity.APIMethod)        {}
+func (nopObserver) RateLimiterWait(time.Duration) {}
+func (nopObserver) Success(entity.APIMethod)      {}
+func (nopObserver) Error(*APIError)               {}
@@ -0,0 +1,51 @@
+package qrator
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+func TestRateLimitedRequests(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Write([]byte(`{"result":["10.0.0.1"],"error":null,"id":1}`))
+	}))
+	defer server.Close()
+
+	client := New(
+		WithBaseURL(server.URL),
+		WithRateLimiter(rate.NewLimiter(1, 1)),
+		WithRetry(RetryPolicy{MaxRetries: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond, Budget: time.Second}),
+		WithBreaker(BreakerSettings{Failures: 2, OpenTimeout: time.Minute}),
+	)
+
+	wantClasses := []ErrorClass{"", ClassRateLimited, ClassRateLimited}
+	for i, want := range wantClasses {
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		_, err := client.SourceIPsGet(ctx, 1)
+		cancel()
+
+		var class ErrorClass
+		var apiErr *APIError
+		if errors.As(err, &apiErr) {
+			class = apiErr.Class
+		}
+		if class != want {
+			t.Errorf("call %d: got error %v, want class %q", i, err, want)
+		}
+	}
+	if got := requests.Load(); got != 1 {
+		t.Errorf("got %d requests, want 1", got)
+	}
+	if state := client.CircuitState(); state != CircuitClosed {
+		t.Errorf("got circuit %s, want closed", state)
+	}
+}
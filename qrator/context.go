@@ -0,0 +1,25 @@
+package qrator
+
+import (
+	"context"
+
+	"github.com/ezhische/qrator-exporter/qrator/entity"
+)
+
+type methodKey struct{}
+
+type requestMethod struct {
+	methodClass entity.MethodClass
+	method      entity.APIMethod
+}
+
+func withMethod(ctx context.Context, methodClass entity.MethodClass, method entity.APIMethod) context.Context {
+	return context.WithValue(ctx, methodKey{}, requestMethod{methodClass, method})
+}
+
+// MethodFromContext returns the method class and method of a request sent by
+// Client, so a custom http.RoundTripper can tell API calls apart.
+func MethodFromContext(ctx context.Context) (entity.MethodClass, entity.APIMethod, bool) {
+	m, ok := ctx.Value(methodKey{}).(requestMethod)
+	return m.methodClass, m.method, ok
+}
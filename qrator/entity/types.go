@@ -0,0 +1,148 @@
+package entity
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// QratorResponse is the JSON-RPC envelope of every API response. Result is
+// decoded by the caller into the type of the method.
+type QratorResponse struct {
+	Result json.RawMessage `json:"result"`
+	Error  json.RawMessage `json:"error"` // null on success, usually a string
+	ID     int             `json:"id"`
+}
+
+type HTTPStatsResult struct {
+	Time      int64              `json:"time"`
+	Requests  float64            `json:"requests"`
+	Responses HTTPStatsDurations `json:"responses"`
+	Errors    HTTPStatErrors     `json:"errors"`
+}
+
+type HTTPStatsDurations struct {
+	Duration0000_0200 float64 `json:"0000_0200"`
+	Duration0200_0500 float64 `json:"0200_0500"`
+	Duration0500_0700 float64 `json:"0500_0700"`
+	Duration0700_1000 float64 `json:"0700_1000"`
+	Duration1000_1500 float64 `json:"1000_1500"`
+	Duration1500_2000 float64 `json:"1500_2000"`
+	Duration2000_5000 float64 `json:"2000_5000"`
+	Duration5000_Inf  float64 `json:"5000_inf"`
+}
+
+type HTTPStatErrors struct {
+	Total   float64 `json:"total"`
+	Code500 float64 `json:"500"`
+	Code501 float64 `json:"501"`
+	Code502 float64 `json:"502"`
+	Code503 float64 `json:"503"`
+	Code504 float64 `json:"504"`
+	Code4xx float64 `json:"4xx"`
+}
+
+type DomainIPStatsResult struct {
+	Time      int64         `json:"time"`
+	Bandwidth IPStatistics  `json:"bandwidth"`
+	Packets   IPStatistics  `json:"packets"`
+	Blacklist BlacklistStat `json:"blacklist"`
+}
+
+type IPStatistics struct {
+	Input  float64 `json:"input"`
+	Passed float64 `json:"passed"`
+	Output float64 `json:"output"`
+}
+
+type BlacklistStat struct {
+	Qrator float64 `json:"qrator"`
+	API    float64 `json:"api"`
+	WAF    float64 `json:"waf"`
+	Custom float64 `json:"custom"`
+}
+
+// DNSStatsResult is the current DNS statistics of a domain with DNS
+// protection.
+type DNSStatsResult struct {
+	Time     int64   `json:"time"`
+	Requests float64 `json:"requests"`
+	// Responses is the response rate by DNS response code, e.g. "noerror"
+	Responses map[string]float64 `json:"responses"`
+}
+
+// DomainUpstream is an origin server Qrator proxies traffic of the domain to.
+type DomainUpstream struct {
+	IP     string `json:"ip"`
+	Weight int    `json:"weight"`
+	Backup bool   `json:"backup"`
+}
+
+// DomainService is a port of the domain protected by Qrator.
+type DomainService struct {
+	Type string `json:"type"`
+	Port int    `json:"port"`
+}
+
+// ListEntry is an IP of the domain blacklist or whitelist.
+type ListEntry struct {
+	IP string `json:"ip"`
+	// Expires is the Unix time the entry is removed at, 0 if it's permanent
+	Expires int64 `json:"expires"`
+}
+
+// Certificate is a TLS certificate uploaded to Qrator.
+type Certificate struct {
+	ID       int             `json:"id"`
+	Subject  string          `json:"subject"`
+	NotAfter CertificateTime `json:"notAfter"`
+}
+
+// CertificateTime is a certificate validity date. The API may return it as
+// Unix time or as a date string.
+type CertificateTime struct {
+	time.Time
+}
+
+// certificateTimeLayouts are the accepted string formats of CertificateTime.
+var certificateTimeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"Jan _2 15:04:05 2006 MST",
+	"2006-01-02",
+}
+
+func (t *CertificateTime) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	var unix int64
+	if err := json.Unmarshal(data, &unix); err == nil {
+		t.Time = time.Unix(unix, 0).UTC()
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("certificate time must be a number or a string: %w", err)
+	}
+	for _, layout := range certificateTimeLayouts {
+		if parsed, err := time.Parse(layout, s); err == nil {
+			t.Time = parsed
+			return nil
+		}
+	}
+	return fmt.Errorf("can't parse certificate time %q", s)
+}
+
+type QratorRequest struct {
+	Method string `json:"method"`
+	Params string `json:"params"`
+	ID     int    `json:"id"`
+}
+
+type QratorDomain struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	Status   string `json:"status"`
+	QratorIP string `json:"qratorIp"`
+}
@@ -0,0 +1,54 @@
+package entity
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestCertificateTimeUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    time.Time
+		wantErr bool
+	}{
+		{name: "null", data: `null`, want: time.Time{}},
+		{name: "unix time", data: `1735689600`, want: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "RFC 3339", data: `"2025-01-01T12:30:00Z"`, want: time.Date(2025, 1, 1, 12, 30, 0, 0, time.UTC)},
+		{name: "RFC 3339 with offset", data: `"2025-01-01T15:30:00+03:00"`, want: time.Date(2025, 1, 1, 12, 30, 0, 0, time.UTC)},
+		{name: "date and time", data: `"2025-01-01 12:30:00"`, want: time.Date(2025, 1, 1, 12, 30, 0, 0, time.UTC)},
+		{name: "openssl", data: `"Jan  1 12:30:00 2025 GMT"`, want: time.Date(2025, 1, 1, 12, 30, 0, 0, time.UTC)},
+		{name: "date", data: `"2025-01-01"`, want: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "unknown layout", data: `"01/01/2025"`, wantErr: true},
+		{name: "wrong type", data: `true`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got CertificateTime
+			err := json.Unmarshal([]byte(tt.data), &got)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %v, want error", got.Time)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("got %v, want %v", got.Time, tt.want)
+			}
+		})
+	}
+}
+
+func TestCertificateNotAfter(t *testing.T) {
+	var cert Certificate
+	if err := json.Unmarshal([]byte(`{"id":7,"subject":"CN=example.com","notAfter":"2025-01-01"}`), &cert); err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC); !cert.NotAfter.Equal(want) {
+		t.Errorf("got %v, want %v", cert.NotAfter.Time, want)
+	}
+}
@@ -0,0 +1,81 @@
+package qrator
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ezhische/qrator-exporter/qrator/entity"
+)
+
+// ErrCircuitOpen is returned without calling the API while the circuit
+// breaker is open.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// ErrToken is returned when the TokenSource fails.
+var ErrToken = errors.New("can't get auth token")
+
+// ErrRateLimited is returned without calling the API when the rate limiter
+// can't let the request through before the context is done.
+var ErrRateLimited = errors.New("rate limiter")
+
+// ErrorClass tells what kind of failure an APIError is.
+type ErrorClass string
+
+const (
+	// ClassNetwork is a transport error: connection, TLS, proxy.
+	ClassNetwork ErrorClass = "network"
+	// ClassTimeout is a request cancelled by context or client timeout.
+	ClassTimeout ErrorClass = "timeout"
+	// ClassCircuitOpen is a request rejected by the circuit breaker.
+	ClassCircuitOpen ErrorClass = "circuit_open"
+	// ClassRateLimited is a request which didn't get through the rate
+	// limiter in time.
+	ClassRateLimited ErrorClass = "rate_limited"
+	// ClassAuth is a failure to get the auth token from TokenSource.
+	ClassAuth ErrorClass = "auth"
+	// ClassHTTP is a response with non-200 HTTP status.
+	ClassHTTP ErrorClass = "http"
+	// ClassDecode is a response body which is not valid JSON-RPC.
+	ClassDecode ErrorClass = "decode"
+	// ClassAPI is an error returned by the API in the response envelope.
+	ClassAPI ErrorClass = "api"
+)
+
+func (c ErrorClass) String() string {
+	return string(c)
+}
+
+// APIError describes a failed API call. Use errors.As to get it from errors
+// returned by Client.
+type APIError struct {
+	Class       ErrorClass
+	MethodClass entity.MethodClass
+	Method      entity.APIMethod
+	// ID is the domain ID for domain methods and the client ID for client
+	// methods.
+	ID int
+	// StatusCode is the HTTP status, zero if no response was received.
+	StatusCode int
+	// Message is the error message returned by the server.
+	Message string
+	// Err is the underlying error, if any.
+	Err error
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("%s %s for id %d: %s error", e.MethodClass, e.Method, e.ID, e.Class)
+	if e.StatusCode != 0 && e.StatusCode != 200 {
+		msg += fmt.Sprintf(", status %d", e.StatusCode)
+	}
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
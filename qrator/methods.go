@@ -0,0 +1,126 @@
+package qrator
+
+import (
+	"context"
+
+	"github.com/ezhische/qrator-exporter/qrator/entity"
+)
+
+// DomainsGet returns all domains of the client.
+func (c *Client) DomainsGet(ctx context.Context, clientID int) ([]entity.QratorDomain, error) {
+	var domains []entity.QratorDomain
+	if err := c.call(ctx, entity.Client, clientID, entity.GetDomains, &domains); err != nil {
+		return nil, err
+	}
+	return domains, nil
+}
+
+// SourceIPsGet returns Qrator source IPs of the client. It is also a cheap
+// way to check the API access.
+func (c *Client) SourceIPsGet(ctx context.Context, clientID int) ([]string, error) {
+	var ips []string
+	if err := c.call(ctx, entity.Client, clientID, entity.Ping, &ips); err != nil {
+		return nil, err
+	}
+	return ips, nil
+}
+
+// DomainName returns the name of the domain.
+func (c *Client) DomainName(ctx context.Context, domainID int) (string, error) {
+	var name string
+	if err := c.call(ctx, entity.Domain, domainID, entity.Name, &name); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// DomainHTTPStats returns current HTTP statistics of the domain.
+func (c *Client) DomainHTTPStats(ctx context.Context, domainID int) (*entity.HTTPStatsResult, error) {
+	stats := &entity.HTTPStatsResult{}
+	if err := c.call(ctx, entity.Domain, domainID, entity.HTTP, stats); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// DomainIPStats returns current IP statistics of the domain.
+func (c *Client) DomainIPStats(ctx context.Context, domainID int) (*entity.DomainIPStatsResult, error) {
+	stats := &entity.DomainIPStatsResult{}
+	if err := c.call(ctx, entity.Domain, domainID, entity.IP, stats); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// DomainBillableStats returns billable traffic of the domain (Mbps).
+func (c *Client) DomainBillableStats(ctx context.Context, domainID int) (float64, error) {
+	var bill float64
+	if err := c.call(ctx, entity.Domain, domainID, entity.Bill, &bill); err != nil {
+		return 0, err
+	}
+	return bill, nil
+}
+
+// DomainDNSStats returns current DNS statistics of the domain. The API
+// returns an error for domains without DNS protection.
+func (c *Client) DomainDNSStats(ctx context.Context, domainID int) (*entity.DNSStatsResult, error) {
+	stats := &entity.DNSStatsResult{}
+	if err := c.call(ctx, entity.Domain, domainID, entity.DNS, stats); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// DomainUpstreams returns upstreams of the domain.
+func (c *Client) DomainUpstreams(ctx context.Context, domainID int) ([]entity.DomainUpstream, error) {
+	var upstreams []entity.DomainUpstream
+	if err := c.call(ctx, entity.Domain, domainID, entity.Upstreams, &upstreams); err != nil {
+		return nil, err
+	}
+	return upstreams, nil
+}
+
+// DomainServices returns protected services of the domain.
+func (c *Client) DomainServices(ctx context.Context, domainID int) ([]entity.DomainService, error) {
+	var services []entity.DomainService
+	if err := c.call(ctx, entity.Domain, domainID, entity.Services, &services); err != nil {
+		return nil, err
+	}
+	return services, nil
+}
+
+// DomainBlacklist returns the custom blacklist of the domain.
+func (c *Client) DomainBlacklist(ctx context.Context, domainID int) ([]entity.ListEntry, error) {
+	var entries []entity.ListEntry
+	if err := c.call(ctx, entity.Domain, domainID, entity.Blacklist, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// DomainWhitelist returns the whitelist of the domain.
+func (c *Client) DomainWhitelist(ctx context.Context, domainID int) ([]entity.ListEntry, error) {
+	var entries []entity.ListEntry
+	if err := c.call(ctx, entity.Domain, domainID, entity.Whitelist, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// CertificatesGet returns TLS certificates uploaded by the client.
+func (c *Client) CertificatesGet(ctx context.Context, clientID int) ([]entity.Certificate, error) {
+	var certs []entity.Certificate
+	if err := c.call(ctx, entity.Client, clientID, entity.Certificates, &certs); err != nil {
+		return nil, err
+	}
+	return certs, nil
+}
+
+// DomainCertificates returns TLS certificates of the domain.
+func (c *Client) DomainCertificates(ctx context.Context, domainID int) ([]entity.Certificate, error) {
+	var certs []entity.Certificate
+	if err := c.call(ctx, entity.Domain, domainID, entity.Certificates, &certs); err != nil {
+		return nil, err
+	}
+	return certs, nil
+}
@@ -0,0 +1,70 @@
+package qrator
+
+import (
+	"context"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy configures retries of failed API requests.
+type RetryPolicy struct {
+	// MaxRetries is the number of retries after the first attempt.
+	MaxRetries int
+	// InitialBackoff is the upper bound of the first delay, it doubles on
+	// every retry up to MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// Budget limits the total time spent on one request including retries.
+	Budget time.Duration
+}
+
+// retryable reports whether a request that ended with resp and err is worth
+// another attempt: network errors, 5xx and 429 responses.
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError
+}
+
+// backoff returns the delay before retry number attempt (starting at 0) using
+// exponential backoff with full jitter. Retry-After of a 429 response is used
+// as the lower bound.
+func (p RetryPolicy) backoff(attempt int, resp *http.Response) time.Duration {
+	limit := p.maxDelay(attempt)
+	var delay time.Duration
+	if limit > 0 {
+		delay = rand.N(limit)
+	}
+	if resp != nil && resp.StatusCode == http.StatusTooManyRequests {
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			if after := time.Duration(seconds) * time.Second; after > delay {
+				delay = after
+			}
+		}
+	}
+	return delay
+}
+
+// maxDelay returns the upper bound of the delay before retry number attempt.
+// The shift is checked against MaxBackoff first, so it can't overflow.
+func (p RetryPolicy) maxDelay(attempt int) time.Duration {
+	if p.InitialBackoff <= 0 || p.InitialBackoff > p.MaxBackoff>>attempt {
+		return p.MaxBackoff
+	}
+	return p.InitialBackoff << attempt
+}
+
+// sleep waits for d or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,140 @@
+package qrator
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		err    error
+		want   bool
+	}{
+		{name: "network error", err: errors.New("connection refused"), want: true},
+		{name: "ok", status: http.StatusOK, want: false},
+		{name: "bad request", status: http.StatusBadRequest, want: false},
+		{name: "unauthorized", status: http.StatusUnauthorized, want: false},
+		{name: "too many requests", status: http.StatusTooManyRequests, want: true},
+		{name: "internal server error", status: http.StatusInternalServerError, want: true},
+		{name: "bad gateway", status: http.StatusBadGateway, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var resp *http.Response
+			if tt.err == nil {
+				resp = &http.Response{StatusCode: tt.status}
+			}
+			if got := retryable(resp, tt.err); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryMaxDelay(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  RetryPolicy
+		attempt int
+		want    time.Duration
+	}{
+		{
+			name:    "first retry",
+			policy:  RetryPolicy{InitialBackoff: 200 * time.Millisecond, MaxBackoff: 5 * time.Second},
+			attempt: 0,
+			want:    200 * time.Millisecond,
+		},
+		{
+			name:    "doubles",
+			policy:  RetryPolicy{InitialBackoff: 200 * time.Millisecond, MaxBackoff: 5 * time.Second},
+			attempt: 3,
+			want:    1600 * time.Millisecond,
+		},
+		{
+			name:    "capped",
+			policy:  RetryPolicy{InitialBackoff: 200 * time.Millisecond, MaxBackoff: 5 * time.Second},
+			attempt: 5,
+			want:    5 * time.Second,
+		},
+		{
+			// 200ms << 37 wraps around to a positive value
+			name:    "shift overflow",
+			policy:  RetryPolicy{InitialBackoff: 200 * time.Millisecond, MaxBackoff: 5 * time.Second},
+			attempt: 37,
+			want:    5 * time.Second,
+		},
+		{
+			// the shifted value wraps to 8.6s, below MaxBackoff
+			name:    "shift overflow below max",
+			policy:  RetryPolicy{InitialBackoff: 1<<31 + 1, MaxBackoff: time.Minute},
+			attempt: 33,
+			want:    time.Minute,
+		},
+		{
+			name:    "shift past width",
+			policy:  RetryPolicy{InitialBackoff: time.Second, MaxBackoff: time.Minute},
+			attempt: 100,
+			want:    time.Minute,
+		},
+		{
+			name:    "no initial backoff",
+			policy:  RetryPolicy{MaxBackoff: time.Second},
+			attempt: 1,
+			want:    time.Second,
+		},
+		{
+			name:    "no backoff",
+			policy:  RetryPolicy{},
+			attempt: 1,
+			want:    0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.maxDelay(tt.attempt); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	policy := RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	response := func(status int, retryAfter string) *http.Response {
+		resp := &http.Response{StatusCode: status, Header: http.Header{}}
+		if retryAfter != "" {
+			resp.Header.Set("Retry-After", retryAfter)
+		}
+		return resp
+	}
+
+	tests := []struct {
+		name    string
+		policy  RetryPolicy
+		attempt int
+		resp    *http.Response
+		// the delay must be in [min, max)
+		min, max time.Duration
+	}{
+		{name: "network error", policy: policy, attempt: 0, min: 0, max: 100 * time.Millisecond},
+		{name: "jitter below cap", policy: policy, attempt: 60, resp: response(http.StatusBadGateway, ""), min: 0, max: time.Second},
+		{name: "retry after is lower bound", policy: policy, attempt: 0, resp: response(http.StatusTooManyRequests, "3"), min: 3 * time.Second, max: 3*time.Second + 1},
+		{name: "retry after below jitter", policy: policy, attempt: 0, resp: response(http.StatusTooManyRequests, "0"), min: 0, max: 100 * time.Millisecond},
+		{name: "retry after ignored without 429", policy: policy, attempt: 0, resp: response(http.StatusServiceUnavailable, "3"), min: 0, max: 100 * time.Millisecond},
+		{name: "retry after date is ignored", policy: policy, attempt: 0, resp: response(http.StatusTooManyRequests, "Wed, 21 Oct 2015 07:28:00 GMT"), min: 0, max: 100 * time.Millisecond},
+		{name: "no backoff", policy: RetryPolicy{}, attempt: 2, min: 0, max: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 100; i++ {
+				if got := tt.policy.backoff(tt.attempt, tt.resp); got < tt.min || got >= tt.max {
+					t.Fatalf("got %v, want in [%v, %v)", got, tt.min, tt.max)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package qrator
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TokenSource returns the X-Qrator-Auth token for every request.
+type TokenSource interface {
+	Token() (string, error)
+}
+
+type staticToken string
+
+func (t staticToken) Token() (string, error) {
+	return string(t), nil
+}
+
+// FileToken reads the token from a file, e.g. a mounted secret. The file is
+// read again whenever its modification time or size changes, so a rotated
+// token is picked up without restart.
+type FileToken struct {
+	path    string
+	modTime time.Time
+	size    int64
+	token   string
+	sync.Mutex
+}
+
+func NewFileToken(path string) *FileToken {
+	return &FileToken{path: path}
+}
+
+func (f *FileToken) Token() (string, error) {
+	f.Lock()
+	defer f.Unlock()
+
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return "", fmt.Errorf("can't read token file: %w", err)
+	}
+	if f.token != "" && info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return f.token, nil
+	}
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return "", fmt.Errorf("can't read token file: %w", err)
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", errors.New("token file " + f.path + " is empty")
+	}
+	f.token, f.modTime, f.size = token, info.ModTime(), info.Size()
+	return f.token, nil
+}